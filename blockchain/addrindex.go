@@ -0,0 +1,308 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+
+	"github.com/pierobassa/golang-blockchain/network"
+)
+
+/*
+The address index is an optional index of the Badger DB with the history of every address:
+the transactions that credit it (outputs it owns) or debit it (inputs spending outputs it owns).
+
+The key of an entry is the prefix + SHA256 of the address + height of the block + position of the transaction in the block,
+so iterating over the keys of an address gives its transactions in height order.
+The keys written for a block are saved under the block hash so they can be removed when the block is disconnected.
+*/
+var (
+	addrIndexPrefix      = []byte("addr-")
+	addrIndexBlockPrefix = []byte("addrblk-")
+	addrIndexKey         = []byte("addrindex") //Present in the DB when the index is enabled
+)
+
+type AddressIndex struct {
+	Blockchain *Blockchain
+}
+
+/*
+A transaction in the history of an address
+  - Received: tokens of the outputs owned by the address
+  - Sent: tokens of the outputs owned by the address spent by the inputs
+  - Balance: balance of the address after the transaction (computed when reading the history)
+*/
+type AddressTx struct {
+	TxID     []byte
+	Height   int
+	Received Amount
+	Sent     Amount
+	Balance  Amount
+}
+
+/*
+The account that owns an output in the address index:
+  - data outputs have no owner
+  - pay-to-script-hash outputs belong to the address of the script
+  - HTLC outputs belong to the sender until they are redeemed
+*/
+func (out *TxOutput) Owner(params *network.ChainParams) string {
+	switch {
+	case out.IsData():
+		return ""
+	case out.IsScriptHash():
+		return scriptHashAddress(out.ScriptHash, params)
+	case out.IsHTLC():
+		return out.Refund
+	}
+
+	return out.PubKey
+}
+
+func (idx AddressIndex) Enabled() bool {
+	_, err := idx.Blockchain.Database.Get(addrIndexKey)
+	if err == ErrNotFound {
+		return false
+	}
+	Handle(err)
+
+	return true
+}
+
+/*
+Builds the index from the whole blockchain and enables it.
+The blocks are connected from the Genesis block onwards keeping every output in memory to know who owns the spent ones.
+The indexes are marked as out of sync until the rebuild is complete (see Blockchain.Repair)
+*/
+func (idx AddressIndex) Reindex() {
+	idx.Blockchain.writeMu.Lock()
+	defer idx.Blockchain.writeMu.Unlock()
+
+	idx.reindex()
+}
+
+func (idx AddressIndex) reindex() {
+	idx.Blockchain.markIndexesStale()
+
+	err := idx.Blockchain.Database.DeleteByPrefix(addrIndexPrefix)
+	Handle(err)
+	err = idx.Blockchain.Database.DeleteByPrefix(addrIndexBlockPrefix)
+	Handle(err)
+
+	var blocks []*Block
+	iter := idx.Blockchain.Iterator()
+
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		blocks = append(blocks, block)
+	}
+	Handle(iter.Err())
+
+	outputs := make(map[string]TxOutput) //outpoint -> output
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		err = idx.Blockchain.Database.Update(func(batch Batch) error {
+			idx.connect(batch, blocks[i], func(in *TxInput) (TxOutput, bool) {
+				out, found := outputs[formatOutpoint(in.ID, in.Out)]
+				return out, found
+			})
+			return nil
+		})
+		Handle(err)
+
+		for _, tx := range blocks[i].Transactions {
+			for outIdx, out := range tx.Outputs {
+				outputs[formatOutpoint(tx.ID, outIdx)] = out
+			}
+		}
+	}
+
+	err = idx.Blockchain.Database.Update(func(batch Batch) error {
+		return batch.Set(addrIndexKey, []byte{1})
+	})
+	Handle(err)
+
+	idx.Blockchain.markIndexesSynced()
+}
+
+/*
+Adds the transactions of a block as part of the batch that connects it to the blockchain.
+It must be called before the UTXO set is updated in the batch, as the outputs spent by the block are looked up in it
+*/
+func (idx AddressIndex) ConnectBlock(batch Batch, block *Block) {
+	idx.connect(batch, block, func(in *TxInput) (TxOutput, bool) {
+		out, _, found := findOutput(batch.Get, in.ID, in.Out)
+		return out, found
+	})
+}
+
+/*
+Removes the transactions of a block as part of the batch that disconnects it from the blockchain
+*/
+func (idx AddressIndex) DisconnectBlock(batch Batch, block *Block) {
+	blockKey := append(append([]byte{}, addrIndexBlockPrefix...), block.Hash...)
+
+	v, err := batch.Get(blockKey)
+	if err == ErrNotFound {
+		return
+	}
+	Handle(err)
+
+	for _, key := range deserializeKeys(v) {
+		err = batch.Delete(key)
+		Handle(err)
+	}
+
+	err = batch.Delete(blockKey)
+	Handle(err)
+}
+
+/*
+Returns a page of the history of an address in height order
+
+@param skip: number of transactions to skip from the oldest
+@param count: maximum number of transactions returned (0 for all of them)
+@returns: the transactions with the balance after each of them and the total number of transactions of the address
+*/
+func (idx AddressIndex) History(address string, skip, count int) ([]AddressTx, int) {
+	var history []AddressTx
+	var balance Amount
+	total := 0
+
+	prefix := addressPrefix(address)
+
+	err := idx.Blockchain.Database.Iterate(prefix, func(key, v []byte) error {
+		entry := deserializeAddressTx(v)
+
+		//The running balance must include the transactions before the page
+		var err error
+		balance, err = balance.Add(entry.Received)
+		Handle(err)
+		balance, err = balance.Sub(entry.Sent)
+		Handle(err)
+		entry.Balance = balance
+
+		if total >= skip && (count == 0 || len(history) < count) {
+			history = append(history, entry)
+		}
+		total++
+
+		return nil
+	})
+	Handle(err)
+
+	return history, total
+}
+
+/*
+Writes the entries of a block in the batch. 'spentOutput' returns the output spent by an input
+*/
+func (idx AddressIndex) connect(batch Batch, block *Block, spentOutput func(in *TxInput) (TxOutput, bool)) {
+	var keys [][]byte
+
+	for position, tx := range block.Transactions {
+		entries := make(map[string]*AddressTx) //address -> entry of the transaction
+
+		entry := func(address string) *AddressTx {
+			if entries[address] == nil {
+				entries[address] = &AddressTx{TxID: tx.ID, Height: block.Height}
+			}
+			return entries[address]
+		}
+
+		var err error
+
+		if tx.isCoinbase() == false {
+			for _, in := range tx.Inputs {
+				out, found := spentOutput(&in)
+				if !found || out.Owner(idx.Blockchain.Params) == "" {
+					continue
+				}
+
+				e := entry(out.Owner(idx.Blockchain.Params))
+				e.Sent, err = e.Sent.Add(out.Value)
+				Handle(err)
+			}
+		}
+
+		for _, out := range tx.Outputs {
+			if out.Owner(idx.Blockchain.Params) == "" {
+				continue
+			}
+
+			e := entry(out.Owner(idx.Blockchain.Params))
+			e.Received, err = e.Received.Add(out.Value)
+			Handle(err)
+		}
+
+		for address, e := range entries {
+			key := addressEntryKey(address, block.Height, position)
+
+			err = batch.Set(key, e.serialize())
+			Handle(err)
+
+			keys = append(keys, key)
+		}
+	}
+
+	blockKey := append(append([]byte{}, addrIndexBlockPrefix...), block.Hash...)
+
+	err := batch.Set(blockKey, serializeKeys(keys))
+	Handle(err)
+}
+
+func addressPrefix(address string) []byte {
+	addressHash := sha256.Sum256([]byte(address)) //Fixed length so an address is never the prefix of another one
+
+	return append(append([]byte{}, addrIndexPrefix...), addressHash[:]...)
+}
+
+func addressEntryKey(address string, height int, position int) []byte {
+	key := addressPrefix(address)
+	key = binary.BigEndian.AppendUint64(key, uint64(height)) //Big endian so the keys are sorted by height
+	key = binary.BigEndian.AppendUint32(key, uint32(position))
+
+	return key
+}
+
+/* -------------- SERIALIZATION & DESERIALIZATION -------------- */
+
+func (e AddressTx) serialize() []byte {
+	var buffer bytes.Buffer
+
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(e)
+	Handle(err)
+
+	return buffer.Bytes()
+}
+
+func deserializeAddressTx(data []byte) AddressTx {
+	var entry AddressTx
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&entry)
+	Handle(err)
+
+	return entry
+}
+
+func serializeKeys(keys [][]byte) []byte {
+	var buffer bytes.Buffer
+
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(keys)
+	Handle(err)
+
+	return buffer.Bytes()
+}
+
+func deserializeKeys(data []byte) [][]byte {
+	var keys [][]byte
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&keys)
+	Handle(err)
+
+	return keys
+}
@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAddressHistory(t *testing.T) {
+	chain := newTestChain(t)
+	index := AddressIndex{chain}
+	index.Reindex()
+
+	tx1 := NewTransaction("alice", nil, "bob", 300, 0, chain)
+	chain.AddBlock("miner", []*Transaction{tx1})
+	tx2 := NewTransaction("bob", nil, "carol", 100, 0, chain)
+	chain.AddBlock("miner", []*Transaction{tx2})
+	tx3 := NewTransaction("alice", nil, "bob", 50, 0, chain)
+	b3 := chain.AddBlock("miner", []*Transaction{tx3})
+
+	want := []AddressTx{
+		{TxID: tx1.ID, Height: 1, Received: 300, Balance: 300},
+		{TxID: tx2.ID, Height: 2, Received: 200, Sent: 300, Balance: 200}, //The change of bob comes back to him
+		{TxID: tx3.ID, Height: 3, Received: 50, Balance: 250},
+	}
+
+	check := func(history []AddressTx, want []AddressTx) {
+		t.Helper()
+
+		if len(history) != len(want) {
+			t.Fatalf("the history has %d transactions, want %d", len(history), len(want))
+		}
+		for i := range want {
+			got := history[i]
+			if !bytes.Equal(got.TxID, want[i].TxID) || got.Height != want[i].Height || got.Received != want[i].Received || got.Sent != want[i].Sent || got.Balance != want[i].Balance {
+				t.Errorf("entry %d = %+v, want %+v", i, got, want[i])
+			}
+		}
+	}
+
+	history, total := index.History("bob", 0, 0)
+	if total != 3 {
+		t.Fatalf("bob has %d transactions, want 3", total)
+	}
+	check(history, want)
+
+	//The running balance of a page includes the transactions of the previous pages
+	history, total = index.History("bob", 1, 1)
+	if total != 3 {
+		t.Fatalf("bob has %d transactions, want 3", total)
+	}
+	check(history, want[1:2])
+
+	if history, _ := index.History("bob", 3, 1); len(history) != 0 {
+		t.Fatalf("the page after the last transaction has %d transactions", len(history))
+	}
+
+	//A rebuild gives the same history as the blocks connected one by one
+	index.Reindex()
+	history, _ = index.History("bob", 0, 0)
+	check(history, want)
+
+	//A disconnected block leaves the history
+	if _, _, err := chain.InvalidateBlock(b3.Hash); err != nil {
+		t.Fatal(err)
+	}
+	history, total = index.History("bob", 0, 0)
+	if total != 2 {
+		t.Fatalf("bob has %d transactions after the disconnection, want 2", total)
+	}
+	check(history, want[:2])
+}
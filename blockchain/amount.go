@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+Amount of tokens expressed in the smallest unit. One coin is UnitsPerCoin units.
+Amounts can't be negative and every sum of untrusted amounts goes through Add so it can't overflow.
+*/
+type Amount uint64
+
+const (
+	UnitsPerCoin Amount = 100000000
+	coinDecimals        = 8 //Number of digits after the decimal point (UnitsPerCoin = 10^coinDecimals)
+)
+
+var ErrAmountOverflow = errors.New("amount overflow")
+
+/*
+Checked addition
+
+@returns: the sum or ErrAmountOverflow if it doesn't fit in 64 bits
+*/
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a > math.MaxUint64-b {
+		return 0, ErrAmountOverflow
+	}
+
+	return a + b, nil
+}
+
+/*
+Checked subtraction
+
+@returns: the difference or an error if b is greater than a
+*/
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, fmt.Errorf("can't subtract %s from %s", b, a)
+	}
+
+	return a - b, nil
+}
+
+/*
+Formats the amount as a decimal number of coins. Ex: 125000000 -> "1.25"
+*/
+func (a Amount) String() string {
+	coins := a / UnitsPerCoin
+	units := a % UnitsPerCoin
+
+	if units == 0 {
+		return strconv.FormatUint(uint64(coins), 10)
+	}
+
+	decimals := strings.TrimRight(fmt.Sprintf("%0*d", coinDecimals, units), "0")
+
+	return fmt.Sprintf("%d.%s", coins, decimals)
+}
+
+/*
+Parses a decimal number of coins. Ex: "1.25" -> 125000000
+
+@returns: the amount or an error if the number is negative, has more than 8 decimals or overflows
+*/
+func ParseAmount(s string) (Amount, error) {
+	whole, fraction, _ := strings.Cut(s, ".")
+
+	if whole == "" && fraction == "" {
+		return 0, errors.New("empty amount")
+	}
+	if strings.HasPrefix(whole, "-") || strings.HasPrefix(whole, "+") || strings.HasPrefix(fraction, "-") || strings.HasPrefix(fraction, "+") {
+		return 0, fmt.Errorf("invalid amount %s: only unsigned numbers are allowed", s)
+	}
+	if len(fraction) > coinDecimals {
+		return 0, fmt.Errorf("invalid amount %s: at most %d decimals are allowed", s, coinDecimals)
+	}
+
+	var coins, units uint64
+	var err error
+
+	if whole != "" {
+		coins, err = strconv.ParseUint(whole, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount %s: %v", s, err)
+		}
+	}
+
+	if fraction != "" {
+		units, err = strconv.ParseUint(fraction+strings.Repeat("0", coinDecimals-len(fraction)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount %s: %v", s, err)
+		}
+	}
+
+	if coins > uint64(math.MaxUint64/UnitsPerCoin) {
+		return 0, ErrAmountOverflow
+	}
+
+	return (Amount(coins) * UnitsPerCoin).Add(Amount(units))
+}
+
+/*
+Checked sum of the values of some outputs
+
+@returns: the sum or ErrAmountOverflow
+*/
+func SumOutputs(outputs []TxOutput) (Amount, error) {
+	var total Amount
+	var err error
+
+	for _, out := range outputs {
+		total, err = total.Add(out.Value)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,91 @@
+package blockchain
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	valid := map[string]Amount{
+		"0":                     0,
+		"1":                     UnitsPerCoin,
+		"1.25":                  125000000,
+		".5":                    50000000,
+		"3.":                    3 * UnitsPerCoin,
+		"0.00000001":            1,
+		"184467440737.09551615": math.MaxUint64,
+	}
+
+	for s, want := range valid {
+		got, err := ParseAmount(s)
+		if err != nil {
+			t.Errorf("ParseAmount(%q): %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", s, got, want)
+		}
+	}
+
+	invalid := []string{
+		"", ".", "-1", "+1", "1.-5", "0.000000001", "1,5", "abc",
+		"184467440737.09551616", //One unit more than the largest amount
+		"184467440738",
+		"99999999999999999999",
+	}
+
+	for _, s := range invalid {
+		if got, err := ParseAmount(s); err == nil {
+			t.Errorf("ParseAmount(%q) = %d, want an error", s, got)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	for amount, want := range map[Amount]string{0: "0", 1: "0.00000001", 125000000: "1.25", 2 * UnitsPerCoin: "2"} {
+		if got := amount.String(); got != want {
+			t.Errorf("Amount(%d).String() = %s, want %s", uint64(amount), got, want)
+		}
+
+		if parsed, err := ParseAmount(want); err != nil || parsed != amount {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", want, parsed, err, uint64(amount))
+		}
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	if sum, err := Amount(math.MaxUint64 - 1).Add(1); err != nil || sum != math.MaxUint64 {
+		t.Errorf("MaxUint64-1 + 1 = %d, %v", sum, err)
+	}
+	if _, err := Amount(math.MaxUint64).Add(1); err != ErrAmountOverflow {
+		t.Errorf("MaxUint64 + 1: %v, want ErrAmountOverflow", err)
+	}
+
+	if diff, err := Amount(5).Sub(5); err != nil || diff != 0 {
+		t.Errorf("5 - 5 = %d, %v", diff, err)
+	}
+	if _, err := Amount(5).Sub(6); err == nil {
+		t.Error("5 - 6: no error")
+	}
+
+	if _, err := SumOutputs([]TxOutput{{Value: math.MaxUint64}, {Value: 1}}); err != ErrAmountOverflow {
+		t.Errorf("SumOutputs: %v, want ErrAmountOverflow", err)
+	}
+}
+
+/*
+Outputs whose sum wraps around 64 bits would otherwise look smaller than the inputs they spend
+*/
+func TestValidateTransactionsRejectsOverflowingOutputs(t *testing.T) {
+	chain := newTestChain(t)
+
+	tx := spendGenesis(t, chain, math.MaxUint64)
+	tx.Outputs = append(tx.Outputs, TxOutput{Value: 2, PubKey: "bob"})
+	tx.SetID()
+
+	err := chain.ValidateTransactions([]*Transaction{CoinbaseTx("miner", "", 1), tx}, 1)
+	if err == nil || !strings.Contains(err.Error(), ErrAmountOverflow.Error()) {
+		t.Fatalf("the overflowing outputs are accepted: %v", err)
+	}
+}
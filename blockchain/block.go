@@ -5,24 +5,36 @@ import (
 	"crypto/sha256"
 	"encoding/gob"
 	"log"
+	"time"
 )
 
 type Block struct {
 	Hash         []byte
 	Transactions []*Transaction //Array of transactions. A block must contain at least 1 transaction
 	PrevHash     []byte
-	Nonce        int //The nonce is the number that blockchain miners are solving for.
+	Nonce        int   //The nonce is the number that blockchain miners are solving for.
+	Height       int   //Number of blocks between this block and the Genesis block (Genesis has height 0)
+	Timestamp    int64 //Unix time at which the block was created
 }
 
 /*
 *
+@param height: height of the new block, which is the height of the block referenced by prevHash plus one
+@param difficulty: difficulty of the chain (see network.ChainParams)
 @returns new pointer to a Block
 */
-func CreateBlock(txs []*Transaction, prevHash []byte) *Block {
-	block := &Block{[]byte{}, txs, prevHash, 0} //block is a reference (&) to a block created with it's constructor.
+func CreateBlock(txs []*Transaction, prevHash []byte, height int, difficulty int) *Block {
+	return mineBlock(txs, prevHash, height, time.Now().Unix(), difficulty)
+}
+
+/*
+Mines a block with the given timestamp. The nonce search always starts from 0, so the same content always gives the same block
+*/
+func mineBlock(txs []*Transaction, prevHash []byte, height int, timestamp int64, difficulty int) *Block {
+	block := &Block{[]byte{}, txs, prevHash, 0, height, timestamp} //block is a reference (&) to a block created with it's constructor.
 
 	//Running the Proof of Work algorithm on the block
-	pow := NewProof(block)
+	pow := NewProof(block, difficulty)
 	nonce, hash := pow.Run()
 
 	block.Hash = hash[:]
@@ -35,8 +47,8 @@ func CreateBlock(txs []*Transaction, prevHash []byte) *Block {
 We need a Genesis block due to the fact that each block references to a previous block.
 @param 'coinbase' is the first transaction
 */
-func Genesis(coinbase *Transaction) *Block {
-	return CreateBlock([]*Transaction{coinbase}, []byte{}) //Genesis block will have an empty slice of bytes as the previous Hash
+func Genesis(coinbase *Transaction, difficulty int) *Block {
+	return CreateBlock([]*Transaction{coinbase}, []byte{}, 0, difficulty) //Genesis block will have an empty slice of bytes as the previous Hash
 }
 
 /*
@@ -1,226 +1,569 @@
 package blockchain
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"github.com/dgraph-io/badger"
+	"github.com/pierobassa/golang-blockchain/network"
+	"log"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sync"
+	"time"
 )
 
-// Path of the database
-const (
-	dbPath      = "./tmp/blocks"
-	dbFile      = "./tmp/blocks/MANIFEST" //to verify if the blockchain db exists (BadgerDB creates this file on initialization of the DB)
-	genesisData = "First Transaction from Genesis"
-)
+// File used to verify if the blockchain db exists (BadgerDB creates this file on initialization of the DB).
+// The database lives in the blocks directory of the network (see network.BlocksDir)
+const dbFile = "MANIFEST"
 
 /*
 Blockchain struct
-  - LastHash: slice of bytes representing the last hash (hash of the last block in the blockchain)
-  - Database: pointer to the Badger database
+  - lastHash: slice of bytes representing the last hash (hash of the last block in the blockchain), read with LastHash
+  - Database: storage of the blocks and of the indexes (see Store)
+  - Params: consensus rules of the chain
+
+A Blockchain is safe for concurrent use: any number of readers and one writer at a time.
+Writers (AddBlock, the rebuild of an index) are serialized by writeMu, which is held while a block is mined,
+while mu only protects lastHash and assumeValidAncestors so readers never wait for the mining.
 */
 type Blockchain struct {
-	LastHash []byte
-	Database *badger.DB
+	lastHash []byte
+	Database Store
+	Params   *network.ChainParams
+
+	assumeValidAncestors map[string]bool     //Hashes of the assumed-valid block and of its ancestors read by FindAssumeValid
+	validation           *snapshotValidation //Validation of the blocks below the snapshot running in the background
+
+	pruneDepth    int //Blocks kept below the last one when a block is connected, 0 disables the pruning (see SetPruneDepth). Guarded by writeMu
+	prunedSinceGC int //Blocks pruned since the last garbage collection of the store. Guarded by writeMu
+
+	mu      sync.RWMutex
+	writeMu sync.Mutex
 }
 
 /*
-Struct used to iterate through the blockchain in the database
+Struct used to iterate through the blockchain in the database, from the last block to the Genesis block.
+CurrentHash is empty once the Genesis block has been returned
 */
 type BlockchainIterator struct {
 	CurrentHash []byte
-	Database    *badger.DB
+	Database    Store
+
+	headers bool //Pruned blocks are returned without their transactions instead of stopping the iteration
+	err     error
 }
 
-func DBExists() bool {
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+func DBExists(params *network.ChainParams) bool {
+	if _, err := os.Stat(filepath.Join(network.BlocksDir(params), dbFile)); os.IsNotExist(err) {
 		return false
 	}
 
 	return true
 }
 
-func ContinueBlockchain(address string) *Blockchain {
-	if DBExists() == false {
+/*
+Opens the blockchain stored in the Badger DB of the network
+*/
+func ContinueBlockchain(address string, params *network.ChainParams) *Blockchain {
+	if DBExists(params) == false {
 		fmt.Println("No existing blockchain found, create one!")
 		runtime.Goexit()
 	}
 
-	var lastHash []byte
-
-	opts := badger.DefaultOptions(dbPath) //DefaultOptions sets a list of recommended options for good performance.
+	store, err := OpenBadgerStore(network.BlocksDir(params))
+	Handle(err)
 
-	db, err := badger.Open(opts)
+	blockchain, err := LoadBlockchain(store, params)
+	if errors.Is(err, ErrSchemaVersion) {
+		fmt.Println(err)
+		store.Close()
+		runtime.Goexit()
+	}
+	if errors.Is(err, ErrInvalidSnapshot) {
+		fmt.Printf("%v: delete %s and start again from another snapshot or from the blocks\n", err, network.BlocksDir(params))
+		store.Close()
+		runtime.Goexit()
+	}
 	Handle(err)
 
-	err = db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
+	//Resumes the validation of the blocks below the snapshot, stopped by Close. Its result is logged, it can come during any output
+	err = blockchain.StartSnapshotValidation(func(err error) {
+		if err != nil {
+			log.Printf("Snapshot validation failed: %v", err)
+			return
+		}
 
-		err = item.Value(func(val []byte) error {
-			lastHash = append([]byte{}, val...)
+		log.Println("The blocks below the snapshot are validated: the snapshot matches the blocks")
+	})
+	if err != nil {
+		fmt.Printf("The blocks below the snapshot can't be validated: %v (run validatesnapshot with another bootstrap file)\n", err)
+	}
 
-			return nil
-		})
+	return blockchain
+}
 
-		return err
-	})
+/*
+Loads the blockchain of a store that already has one.
+The UTXO set and the indexes are rebuilt if they don't reflect the last block (see CheckConsistency)
 
-	Handle(err)
+@returns: the blockchain or an error if the store has no blockchain, has another schema version (see Migrate) or was started from an invalid snapshot
+*/
+func LoadBlockchain(store Store, params *network.ChainParams) (*Blockchain, error) {
+	lastHash, err := store.GetTip()
+	if err == ErrNotFound {
+		return nil, errors.New("no existing blockchain found in the store")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSchemaVersion(store); err != nil {
+		return nil, err
+	}
+
+	if _, err := store.GetBlock(lastHash); err != nil {
+		return nil, fmt.Errorf("the last hash %x doesn't point to a block: %v", lastHash, err)
+	}
+
+	blockchain := Blockchain{lastHash: lastHash, Database: store, Params: params}
+
+	if base, found := blockchain.snapshotBase(); found && base.Invalid {
+		return nil, ErrInvalidSnapshot
+	}
+
+	if problems := blockchain.CheckConsistency(); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Printf("Inconsistent blockchain: %s\n", problem)
+		}
+
+		if err := blockchain.checkNotPruned("rebuilding the UTXO set and the indexes"); err != nil {
+			return nil, err
+		}
 
-	blockchain := Blockchain{lastHash, db}
+		fmt.Println("Rebuilding the UTXO set and the indexes...")
+		blockchain.Repair()
+	}
 
-	return &blockchain
+	return &blockchain, nil
 }
 
 /*
 We initialize our blockchain (if it isn't already present) with the first block which is the Genesis Block
 
 @param 'address': address of who inits the blockchain
+@param 'params': consensus rules of the new chain
 */
-func InitBlockchain(address string) *Blockchain {
-	var lastHash []byte
+func InitBlockchain(address string, params *network.ChainParams) *Blockchain {
+	//Check if DB already exists
+	if DBExists(params) {
+		fmt.Println("Blockchain already exists! No need to init the blockchain again")
+		runtime.Goexit()
+	}
+
+	cbtx := CoinbaseTx(address, params.GenesisData, Amount(params.Reward(0))) //Coinbase tx (address is the address that will mine the genesis block and be rewarded)
+	genesis := Genesis(cbtx, params.Difficulty)
+
+	fmt.Println("Genesis created!")
+
+	return InitBlockchainWithGenesis(genesis, params)
+}
+
+/*
+Initializes a blockchain (if it isn't already present) in the Badger DB of the network with the given Genesis block (ex: built from a GenesisSpec)
 
+@param 'genesis': the mined Genesis block
+@param 'params': consensus rules of the new chain
+*/
+func InitBlockchainWithGenesis(genesis *Block, params *network.ChainParams) *Blockchain {
 	//Check if DB already exists
-	if DBExists() {
+	if DBExists(params) {
 		fmt.Println("Blockchain already exists! No need to init the blockchain again")
 		runtime.Goexit()
 	}
 
-	opts := badger.DefaultOptions(dbPath) //DefaultOptions sets a list of recommended options for good performance.
+	err := os.MkdirAll(network.BlocksDir(params), 0755) //Badger only creates the last directory of the path
+	Handle(err)
 
-	db, err := badger.Open(opts)
+	store, err := OpenBadgerStore(network.BlocksDir(params))
 	Handle(err)
 
-	//Update allows us to do Read and Write operations. Meanwhile, 'View' is read-only
-	err = db.Update(func(txn *badger.Txn) error { //'func(txn *badger.Txn) error' is a closure (anonymous function) which has a pointer to a badger transaction and returns an error if it is occurred
-		/*
-		 We'll create the Genesis block and store it in the database
-		 next we'll save the genesis' block's hash as the last block hash (lastHash) in the database
-		*/
+	blockchain, err := NewBlockchain(store, genesis, params)
+	Handle(err)
 
-		//we are getting the value of the last hash which we save last hash in the db with 'lh'
-		cbtx := CoinbaseTx(address, genesisData) //Coinbase tx (address is the address that will mine the genesis block and be rewarded the 100 tokens)
-		genesis := Genesis(cbtx)
+	return blockchain
+}
 
-		fmt.Println("Genesis created!")
+/*
+Creates a blockchain in an empty store (ex: a MemoryStore) with the given Genesis block
 
-		//Adding block to the DB
-		err = txn.Set(genesis.Hash, genesis.Serialize())
-		Handle(err)
+@returns: the blockchain or an error if the store already has one
+*/
+func NewBlockchain(store Store, genesis *Block, params *network.ChainParams) (*Blockchain, error) {
+	if _, err := store.GetTip(); err != ErrNotFound {
+		return nil, errors.New("the store already has a blockchain")
+	}
 
-		//Setting the last hash in the DB
-		err = txn.Set([]byte("lh"), genesis.Hash)
+	//The Genesis block, the last hash and the schema version are written together
+	err := store.Update(func(batch Batch) error {
+		err := batch.PutBlock(genesis)
+		if err != nil {
+			return err
+		}
 
-		lastHash = genesis.Hash
+		err = setSchemaVersion(batch, SchemaVersion)
+		if err != nil {
+			return err
+		}
 
-		return err
+		return batch.SetTip(genesis.Hash)
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	Handle(err)
+	blockchain := Blockchain{lastHash: genesis.Hash, Database: store, Params: params}
+
+	UTXOSet := UTXOSet{&blockchain}
+	UTXOSet.Reindex() //The UTXO set starts with the outputs of the Genesis block
 
-	blockchain := Blockchain{lastHash, db}
-	return &blockchain
+	heightIndex := HeightIndex{&blockchain}
+	heightIndex.Reindex()
+
+	return &blockchain, nil
 }
 
+// Returned when another block was connected while the new block was being mined
+var ErrStaleTip = errors.New("the last block changed while the new block was mined")
+
 /*
 This is a method for a Blockchain struct.
-It adds a new block to the blockchain.
+It validates the transactions, mines a new block on top of the last one and adds it to the blockchain.
+The block starts with a coinbase transaction paying 'miner' the reward of the block plus the fees of the transactions.
+The block, the last hash, the UTXO set, the height index (and the transaction and address indexes when enabled)
+are written in a single atomic batch, so a crash can't leave them out of sync.
+Blocks are added one at a time, readers keep seeing the previous last block until the batch is written.
+
+@returns pointer to the new block
 */
-func (chain *Blockchain) AddBlock(transactions []*Transaction) {
-	var lastHash []byte
+func (chain *Blockchain) AddBlock(miner string, transactions []*Transaction) *Block {
+	chain.writeMu.Lock()
+	defer chain.writeMu.Unlock()
 
-	err := chain.Database.View(func(txn *badger.Txn) error { //Read-only transaction to the db
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
+	lastHash, err := chain.Database.GetTip()
+	Handle(err)
 
-		err = item.Value(func(val []byte) error {
-			lastHash = append([]byte{}, val...)
+	lastBlock, err := chain.Database.GetBlock(lastHash)
+	Handle(err)
+	lastHeight := lastBlock.Height
 
-			return nil
-		})
+	fees, err := chain.fees(transactions)
+	Handle(err)
 
-		return err
-	})
+	reward, err := Amount(chain.Params.Reward(lastHeight + 1)).Add(fees)
+	Handle(err)
+
+	//The height in the data keeps the coinbase transactions paying the same reward to the same miner from having the same ID
+	coinbase := CoinbaseTx(miner, fmt.Sprintf("Coins to %s at height %d", miner, lastHeight+1), reward)
+	transactions = append([]*Transaction{coinbase}, transactions...)
+
+	err = chain.ValidateTransactions(transactions, lastHeight+1)
+	Handle(err)
+
+	//A clock set back can't make the block earlier than the last one
+	timestamp := time.Now().Unix()
+	if timestamp < lastBlock.Timestamp {
+		timestamp = lastBlock.Timestamp
+	}
+
+	newBlock := mineBlock(transactions, lastHash, lastHeight+1, timestamp, chain.Params.Difficulty)
+
+	err = chain.checkCheckpoint(newBlock)
+	Handle(err)
 
+	err = chain.connectBlock(newBlock)
 	Handle(err)
 
-	newBlock := CreateBlock(transactions, lastHash)
+	return newBlock
+}
+
+/*
+Adds a block on top of the last one (its PrevHash), writing it with the last hash and the indexes in a single atomic batch.
+The caller holds writeMu and has already validated the block
+
+@returns: ErrStaleTip if the block doesn't extend the last block anymore
+*/
+func (chain *Blockchain) connectBlock(newBlock *Block) error {
+	lastHash := newBlock.PrevHash
+
+	addressIndex := AddressIndex{chain}
+	UTXOSet := UTXOSet{chain}
+	heightIndex := HeightIndex{chain}
+	txIndex := TxIndex{chain}
+
+	addressIndexEnabled := addressIndex.Enabled()
+	txIndexEnabled := txIndex.Enabled()
+
+	//Now we need to add the block to the database with the last hash and the indexes
+	err := chain.Database.Update(func(batch Batch) error {
+		tip, err := batch.Get(tipKey)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(tip, lastHash) == false { //The block was mined on top of a block that isn't the last one anymore
+			return ErrStaleTip
+		}
 
-	//Now we need to add the block to the database
-	//and update the last hash in the database
-	err = chain.Database.Update(func(txn *badger.Txn) error {
-		err := txn.Set(newBlock.Hash, newBlock.Serialize())
+		if data, err := batch.Get(snapshotKey); err == nil && decodeSnapshotBase(data).Invalid { //Proved invalid in the background
+			return ErrInvalidSnapshot
+		}
+
+		err = batch.PutBlock(newBlock)
 		Handle(err)
 
-		err = txn.Set([]byte("lh"), newBlock.Hash)
+		if addressIndexEnabled {
+			addressIndex.ConnectBlock(batch, newBlock) //Before updating the UTXO set, which still has the outputs spent by the block
+		}
 
-		chain.LastHash = newBlock.Hash
+		UTXOSet.Update(batch, newBlock)
+		heightIndex.ConnectBlock(batch, newBlock)
 
-		return err
+		if txIndexEnabled {
+			txIndex.ConnectBlock(batch, newBlock)
+		}
+
+		indexesTip, err := batch.Get(indexesTipKey)
+		if err == nil && bytes.Equal(indexesTip, lastHash) { //Indexes that were already out of sync stay marked as such
+			err = batch.Set(indexesTipKey, newBlock.Hash)
+			Handle(err)
+		}
+
+		return batch.SetTip(newBlock.Hash)
 	})
+	if err != nil {
+		return err
+	}
+
+	chain.setLastHash(newBlock.Hash)
+
+	if err := chain.pruneConnected(); err != nil { //The block is connected even if the pruning fails, it will be retried with the next block
+		fmt.Printf("Pruning failed: %v\n", err)
+	}
+
+	return nil
+}
+
+/*
+@returns: a copy of the hash of the last block in the blockchain
+*/
+func (chain *Blockchain) LastHash() []byte {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+
+	return append([]byte{}, chain.lastHash...)
+}
 
+func (chain *Blockchain) setLastHash(hash []byte) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	chain.lastHash = append([]byte{}, hash...)
+}
+
+/*
+Returns the height of the last block in the blockchain
+*/
+func (chain *Blockchain) GetBestHeight() int {
+	lastBlock, err := chain.Database.GetBlock(chain.LastHash())
 	Handle(err)
+
+	return lastBlock.Height
 }
 
 /* ------------------ ITERATOR METHODS ------------------- */
 /*
 Function for the Blockchain struct
-Iterator needed to go through the blocks in the blockchain saved in the DB
+Iterator needed to go through the blocks in the blockchain saved in the DB.
+The iterator starts from the last block at the time it is created: blocks are never modified once stored,
+so it always sees the same snapshot of the blockchain even if new blocks are added meanwhile
 
 @returns Pointer to a blochcian iterator which is an iterator for our blockchain
 */
 func (chain *Blockchain) Iterator() *BlockchainIterator {
-	iter := &BlockchainIterator{chain.LastHash, chain.Database}
+	iter := &BlockchainIterator{CurrentHash: chain.LastHash(), Database: chain.Database}
+
+	return iter
+}
+
+/*
+Iterator that also goes through the pruned blocks, returned without their transactions (ex: to rebuild the height index)
+*/
+func (chain *Blockchain) headerIterator() *BlockchainIterator {
+	iter := chain.Iterator()
+	iter.headers = true
 
 	return iter
 }
 
 /*
 We want to iterate 'backwords'. Which means that we are iterating from the most recent block to the oldest (Genesis block)
-@returns a pointer to the next block in the blockchain
+@returns a pointer to the next block in the blockchain, nil after the Genesis block or if a block is missing (see Err)
 */
 func (iter *BlockchainIterator) Next() *Block {
+	if len(iter.CurrentHash) == 0 || iter.err != nil {
+		return nil
+	}
+
 	var block *Block
+	var err error
 
-	err := iter.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(iter.CurrentHash)
+	if iter.headers {
+		block, err = getHeader(iter.Database.Get, iter.CurrentHash)
+	} else {
+		block, err = iter.Database.GetBlock(iter.CurrentHash)
+	}
 
-		var encodedBlock []byte
+	if err == ErrNotFound {
+		err = fmt.Errorf("block %x does not exist", iter.CurrentHash)
+	} else if err != nil {
+		err = fmt.Errorf("block %x: %w", iter.CurrentHash, err)
+	}
+	if err != nil {
+		iter.err = err
+		return nil
+	}
 
-		err = item.Value(func(val []byte) error { //Since Badger 1.6.0 we need to get the value this way and not with simple 'Value()'
-			encodedBlock = append([]byte{}, val...)
+	iter.CurrentHash = block.PrevHash //We are now chaning the iterator to the previous block
 
-			return nil
-		})
+	return block
+}
 
-		//Alternative to Value()  you could also use item.ValueCopy().
-		//ex: encodedBlock, err = item.ValueCopy(nil)
+/*
+@returns: the error that stopped the iteration, nil if the iteration reached the Genesis block
+*/
+func (iter *BlockchainIterator) Err() error {
+	return iter.err
+}
 
-		block = Deserialize(encodedBlock)
+/*
+Finds a transaction given its ID
 
-		return err
-	})
+@returns: the transaction or an error if it doesn't exist
+*/
+func (chain *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+	tx, _, err := chain.LocateTransaction(ID)
+	if err != nil {
+		return Transaction{}, err
+	}
 
-	Handle(err)
+	return *tx, nil
+}
 
-	iter.CurrentHash = block.PrevHash //We are now chaning the iterator to the previous block
+/*
+Finds a transaction and the block that contains it.
+The transaction index is used when it is enabled, otherwise we go through the whole blockchain
 
-	return block
+@returns: the transaction, its block or an error if it doesn't exist
+*/
+func (chain *Blockchain) LocateTransaction(ID []byte) (*Transaction, *Block, error) {
+	txIndex := TxIndex{chain}
+
+	if txIndex.Enabled() {
+		location, found := txIndex.Find(ID)
+		if !found {
+			return nil, nil, errors.New("transaction does not exist")
+		}
+
+		block, err := chain.GetBlock(location.BlockHash)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return block.Transactions[location.Position], block, nil
+	}
+
+	iter := chain.Iterator()
+
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return tx, block, nil
+			}
+		}
+	}
+
+	if iter.Err() != nil {
+		return nil, nil, iter.Err()
+	}
+
+	return nil, nil, errors.New("transaction does not exist")
+}
+
+/*
+Retrieves the block at 'height' in the active chain
+
+@returns: the block or an error if there's no block at that height
+*/
+func (chain *Blockchain) GetBlockByHeight(height int) (*Block, error) {
+	heightIndex := HeightIndex{chain}
+
+	hash, err := heightIndex.GetHash(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return chain.GetBlock(hash)
+}
+
+/*
+Retrieves a block from the database given its hash
+
+@returns: the block or an error if it doesn't exist
+*/
+func (chain *Blockchain) GetBlock(hash []byte) (*Block, error) {
+	block, err := chain.Database.GetBlock(hash)
+	if err == ErrNotFound {
+		return nil, errors.New("block does not exist")
+	}
+
+	return block, err
 }
 
 /*
-Finds transactions that have outputs NOT referenced by inputs of other transactions.
-These are important because if an input hasn't been spent that means that there are tokens that still exist
-for a certain user.
+Finds the data output carrying 'data' by going through the whole blockchain
+
+@returns: the block that includes the output or an error if no output carries the data
+*/
+func (chain *Blockchain) FindData(data []byte) (*Block, error) {
+	iter := chain.Iterator()
+
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				if out.IsData() && bytes.Equal(out.Data, data) {
+					return block, nil
+				}
+			}
+		}
+	}
+
+	if iter.Err() != nil {
+		return nil, iter.Err()
+	}
+
+	return nil, errors.New("no data output found")
+}
 
-# By summing the unspent transactions for a user we can know his balance of tokens
+/*
+Finds all the Unspent Transaction Outputs by going through the whole blockchain.
+Used to build the UTXO set from scratch.
 
-@param: address: the address of the user
+@returns: map of (transaction ID -> unspent outputs of the transaction and the height of its block)
 */
-func (chain *Blockchain) FindUnspentTransactions(address string) []Transaction {
-	var unspentTxs []Transaction
+func (chain *Blockchain) FindUTXO() map[string]TxOutputs {
+	UTXO := make(map[string]TxOutputs)
 
 	//spent transaction outputs
 	//Creating a map where the keys are strings and values are array (slice) of Integers.
@@ -229,9 +572,7 @@ func (chain *Blockchain) FindUnspentTransactions(address string) []Transaction {
 
 	iter := chain.Iterator()
 
-	for {
-		block := iter.Next()
-
+	for block := iter.Next(); block != nil; block = iter.Next() {
 		//Iterate through the transactions of the current block
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID) //into hexadecimal in string format
@@ -240,86 +581,223 @@ func (chain *Blockchain) FindUnspentTransactions(address string) []Transaction {
 			for outIdx, out := range tx.Outputs {
 				if spentTXOs[txID] != nil {
 					for _, spentOut := range spentTXOs[txID] {
-						if spentOut == outIdx { //This output is a spent output, it can't be part of the UTXs
+						if spentOut == outIdx { //This output is a spent output, it can't be part of the UTXOs
 							continue Outputs //we go to the next output
 						}
 					}
 				}
 
-				//if we reach here, the transaction (tx) is an UNSPENT transaction. Now if the user with address 'address' can unlock the output transaction then it's his and we add it to the array of unspent tranasactions
-				if out.CanBeUnlocked(address) {
-					unspentTxs = append(unspentTxs, *tx)
+				if out.IsData() { //Data outputs are unspendable
+					continue
+				}
+
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = TxOutputs{make(map[int]TxOutput), block.Height, tx.isCoinbase()}
 				}
+				outs.Outputs[outIdx] = out
+				UTXO[txID] = outs
 			}
 
 			//An output is spent if its index is inside a transaction's input
 			if tx.isCoinbase() == false { //a coinbase tx does not have inputs
 				for _, in := range tx.Inputs {
-					if in.CanUnlock(address) {
-						inTxID := hex.EncodeToString(in.ID)
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out) //Adding the output's index to the key (transaction ID) of the map
-					}
+					inTxID := hex.EncodeToString(in.ID)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out) //Adding the output's index to the key (transaction ID) of the map
 				}
 			}
 		}
-
-		if len(block.PrevHash) == 0 { //if we reach genesis block
-			break
-		}
 	}
+	Handle(iter.Err())
+
+	return UTXO
+}
+
+/*
+String that identifies an output: transaction ID and index of the output
+*/
+func formatOutpoint(txID []byte, outIdx int) string {
+	return fmt.Sprintf("%x:%d", txID, outIdx)
+}
 
-	return unspentTxs
+/*
+Checks the transactions that are going to be added in a block at 'height' against the UTXO set and the chain parameters:
+  - the serialized transactions can't exceed the maximum block size
+  - the first transaction, and only that one, is the coinbase transaction. It can't pay more than the reward of the block
+    plus the fees of the other transactions (the tokens of their inputs that their outputs don't spend)
+  - every input must reference an existing unspent output that hasn't already been spent in the same block
+  - pay-to-script-hash inputs must reveal the redeem script matching the hash of the output
+  - the input must be able to unlock the output (for HTLC outputs either with the secret or after the timeout)
+  - the input's sequence must satisfy the output's relative lock and enough blocks must have passed since the output was confirmed
+  - vesting outputs can't be spent before their lock time
+  - coinbase outputs can't be spent before the coinbase maturity
+  - data outputs hold no tokens and respect the size limit, every other output holds at least 1 unit
+  - the sums of the inputs and of the outputs can't overflow and the outputs can't spend more than the inputs
+
+@returns: error describing the first invalid transaction found
+*/
+func (chain *Blockchain) ValidateTransactions(transactions []*Transaction, height int) error {
+	UTXOSet := UTXOSet{chain}
+
+	return chain.validateTransactions(transactions, height, true, UTXOSet.FindOutput)
 }
 
 /*
-Finds the Unspent Transaction Outputs of a given address
+Same checks as ValidateTransactions, with the spent outputs found by 'findOutput' instead of the UTXO set of the last block
+(ex: the UTXO set replayed up to 'height' when the blockchain is verified).
+Without 'checkUnlock' the inputs aren't checked against the outputs they unlock (the block is assumed valid, see assumedValid)
 */
-func (chain *Blockchain) FindUTXO(address string) []TxOutput {
-	var UTXOs []TxOutput
-	unspentTxs := chain.FindUnspentTransactions(address)
+func (chain *Blockchain) validateTransactions(transactions []*Transaction, height int, checkUnlock bool, findOutput func(txID []byte, outIdx int) (TxOutput, TxOutputs, bool)) error {
+	spent := make(map[string]bool) //outputs already spent by previous transactions of the block
+
+	size := 0
+	for _, tx := range transactions {
+		size += len(tx.Serialize())
+	}
+
+	if size > chain.Params.MaxBlockSize {
+		return fmt.Errorf("the transactions take %d bytes, more than the maximum block size (%d bytes)", size, chain.Params.MaxBlockSize)
+	}
+
+	if len(transactions) == 0 || transactions[0].isCoinbase() == false {
+		return errors.New("the first transaction of the block must be the coinbase transaction")
+	}
+
+	var fees Amount
+
+	for _, tx := range transactions[1:] {
+		if tx.isCoinbase() {
+			return fmt.Errorf("transaction %x: a block has a single coinbase transaction", tx.ID)
+		}
+
+		if len(tx.Inputs) == 0 {
+			return fmt.Errorf("transaction %x has no inputs", tx.ID)
+		}
+
+		var inputsValue Amount
+
+		for _, in := range tx.Inputs {
+			outpoint := formatOutpoint(in.ID, in.Out)
+			if spent[outpoint] {
+				return fmt.Errorf("transaction %x: output %s is spent twice", tx.ID, outpoint)
+			}
+			spent[outpoint] = true
+
+			out, outs, found := findOutput(in.ID, in.Out)
+			if !found {
+				return fmt.Errorf("transaction %x: output %s does not exist or is already spent", tx.ID, outpoint)
+			}
+			confHeight := outs.Height
+
+			if outs.IsMature(height, chain.Params.CoinbaseMaturity) == false {
+				return fmt.Errorf("transaction %x: coinbase output %s can't be spent before height %d", tx.ID, outpoint, confHeight+chain.Params.CoinbaseMaturity)
+			}
+
+			conditions, err := out.Conditions(&in)
+			if err != nil {
+				return fmt.Errorf("transaction %x: output %s: %v", tx.ID, outpoint, err)
+			}
+
+			if checkUnlock && in.CanSpend(&conditions, height) == false {
+				return fmt.Errorf("transaction %x: input can't unlock output %s", tx.ID, outpoint)
+			}
+
+			if conditions.CheckSequence(in.Sequence) == false || in.SequenceSatisfied(confHeight, height) == false {
+				return fmt.Errorf("transaction %x: output %s is locked until height %d", tx.ID, outpoint, confHeight+conditions.RelativeLock)
+			}
+
+			if conditions.IsVested(height) == false {
+				return fmt.Errorf("transaction %x: output %s is vesting until height %d", tx.ID, outpoint, conditions.LockTime)
+			}
+
+			inputsValue, err = inputsValue.Add(out.Value)
+			if err != nil {
+				return fmt.Errorf("transaction %x: inputs: %v", tx.ID, err)
+			}
+		}
 
-	for _, tx := range unspentTxs {
 		for _, out := range tx.Outputs {
-			if out.CanBeUnlocked(address) { //If the output is unlockable by the address then it is a UTXO of that address
-				UTXOs = append(UTXOs, out)
+			if out.IsData() && (out.Value != 0 || len(out.Data) > MaxDataSize) {
+				return fmt.Errorf("transaction %x: data outputs can't hold tokens or more than %d bytes", tx.ID, MaxDataSize)
 			}
+
+			if out.IsData() == false && out.Value == 0 {
+				return fmt.Errorf("transaction %x: outputs must hold at least 1 unit", tx.ID)
+			}
+		}
+
+		outputsValue, err := SumOutputs(tx.Outputs)
+		if err != nil {
+			return fmt.Errorf("transaction %x: outputs: %v", tx.ID, err)
+		}
+
+		if outputsValue > inputsValue {
+			return fmt.Errorf("transaction %x: outputs (%s) exceed inputs (%s)", tx.ID, outputsValue, inputsValue)
+		}
+
+		fees, err = fees.Add(inputsValue - outputsValue)
+		if err != nil {
+			return fmt.Errorf("transaction %x: fees: %v", tx.ID, err)
 		}
 	}
 
-	return UTXOs
+	coinbase := transactions[0]
+
+	maxReward, err := Amount(chain.Params.Reward(height)).Add(fees)
+	if err != nil {
+		return fmt.Errorf("coinbase transaction %x: %v", coinbase.ID, err)
+	}
+
+	reward, err := SumOutputs(coinbase.Outputs)
+	if err != nil || reward > maxReward {
+		return fmt.Errorf("coinbase transaction %x pays more than the reward of the block plus the fees (%s)", coinbase.ID, maxReward)
+	}
+
+	return nil
 }
 
 /*
-This method enables creating normal transactions and not only Coinbase transactions.
-To send tokens from one account to another, we need to find the unspent outputs and assure they have enough tokens inside of them.
+@returns: the tokens of the inputs of the transactions that their outputs don't spend (coinbase transactions have no fees)
+*/
+func (chain *Blockchain) fees(transactions []*Transaction) (Amount, error) {
+	UTXOSet := UTXOSet{chain}
 
-@param: address -> address we want to check
-@param: amount -> the amount we want to send (transfer)
+	var fees Amount
 
-@returns: tuple of int and a map of (string -> array of ints)
-*/
-func (chain *Blockchain) FindSpendableOutputs(address string, amount int) (int, map[string][]int) {
-	unspentOuts := make(map[string][]int)
-	unspentTxs := chain.FindUnspentTransactions(address)
+	for _, tx := range transactions {
+		if tx.isCoinbase() {
+			continue
+		}
 
-	accumulated := 0
+		var inputsValue Amount
+		for _, in := range tx.Inputs {
+			out, _, found := UTXOSet.FindOutput(in.ID, in.Out)
+			if !found {
+				return 0, fmt.Errorf("transaction %x: output %s does not exist or is already spent", tx.ID, formatOutpoint(in.ID, in.Out))
+			}
 
-Work:
-	for _, tx := range unspentTxs {
-		txID := hex.EncodeToString(tx.ID)
+			var err error
+			inputsValue, err = inputsValue.Add(out.Value)
+			if err != nil {
+				return 0, fmt.Errorf("transaction %x: inputs: %v", tx.ID, err)
+			}
+		}
 
-		for outIdx, out := range tx.Outputs {
-			if out.CanBeUnlocked(address) && accumulated < amount {
-				accumulated += out.Value
+		outputsValue, err := SumOutputs(tx.Outputs)
+		if err != nil {
+			return 0, fmt.Errorf("transaction %x: outputs: %v", tx.ID, err)
+		}
 
-				unspentOuts[txID] = append(unspentOuts[txID], outIdx)
+		fee, err := inputsValue.Sub(outputsValue)
+		if err != nil {
+			return 0, fmt.Errorf("transaction %x: outputs (%s) exceed inputs (%s)", tx.ID, outputsValue, inputsValue)
+		}
 
-				if accumulated >= amount {
-					break Work //We break from all for loops
-				}
-			}
+		fees, err = fees.Add(fee)
+		if err != nil {
+			return 0, fmt.Errorf("transaction %x: fees: %v", tx.ID, err)
 		}
 	}
 
-	return accumulated, unspentOuts
+	return fees, nil
 }
@@ -0,0 +1,310 @@
+package blockchain
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/pierobassa/golang-blockchain/network"
+)
+
+/*
+Blockchain in a MemoryStore on a copy of the regression test network, whose Genesis block pays the reward to alice
+*/
+func newTestChain(t *testing.T) *Blockchain {
+	t.Helper()
+
+	params := network.RegTest
+
+	genesis := Genesis(CoinbaseTx("alice", params.GenesisData, Amount(params.Reward(0))), params.Difficulty)
+
+	chain, err := NewBlockchain(NewMemoryStore(), genesis, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return chain
+}
+
+/*
+Transaction spending the output of the Genesis block, paying 'value' tokens to bob. The rest are the fees
+*/
+func spendGenesis(t *testing.T, chain *Blockchain, value Amount) *Transaction {
+	t.Helper()
+
+	genesis, err := chain.Database.GetBlock(chain.LastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := &Transaction{
+		Inputs:  []TxInput{{ID: genesis.Transactions[0].ID, Out: 0, Sig: "alice"}},
+		Outputs: []TxOutput{{Value: value, PubKey: "bob"}},
+	}
+	tx.SetID()
+
+	return tx
+}
+
+func TestValidateTransactionsCoinbase(t *testing.T) {
+	chain := newTestChain(t)
+
+	reward := Amount(chain.Params.Reward(1))
+	payment := spendGenesis(t, chain, reward-10) //10 units of fees
+
+	coinbase := func(value Amount) *Transaction {
+		return CoinbaseTx("miner", "", value)
+	}
+
+	valid := [][]*Transaction{
+		{coinbase(reward)},
+		{coinbase(reward + 10), payment},
+		{coinbase(1), payment},
+	}
+
+	for i, transactions := range valid {
+		if err := chain.ValidateTransactions(transactions, 1); err != nil {
+			t.Errorf("valid block %d: %v", i, err)
+		}
+	}
+
+	invalid := map[string][]*Transaction{
+		"no transactions":              nil,
+		"no coinbase":                  {payment},
+		"coinbase after a transaction": {payment, coinbase(reward)},
+		"two coinbases":                {coinbase(reward), CoinbaseTx("other", "", 1)},
+		"reward above the schedule":    {coinbase(reward + 1)},
+		"reward above the fees":        {coinbase(reward + 11), payment},
+		"second coinbase paying a fee": {coinbase(reward), payment, coinbase(1)},
+	}
+
+	for name, transactions := range invalid {
+		if err := chain.ValidateTransactions(transactions, 1); err == nil {
+			t.Errorf("%s: the block was accepted", name)
+		}
+	}
+}
+
+func TestAddBlockPaysTheMiner(t *testing.T) {
+	chain := newTestChain(t)
+
+	reward := Amount(chain.Params.Reward(1))
+	block := chain.AddBlock("miner", []*Transaction{spendGenesis(t, chain, reward-10)})
+
+	if len(block.Transactions) != 2 || block.Transactions[0].isCoinbase() == false {
+		t.Fatalf("the block doesn't start with a coinbase transaction: %v", block.Transactions)
+	}
+
+	if got := block.Transactions[0].Outputs[0]; got.PubKey != "miner" || got.Value != reward+10 {
+		t.Fatalf("the coinbase pays %s to %s, want %s to miner", got.Value, got.PubKey, reward+10)
+	}
+
+	//Two blocks paying the same reward to the same miner have different coinbase transactions
+	next := chain.AddBlock("miner", nil)
+	if bytes.Equal(next.Transactions[0].ID, block.Transactions[0].ID) {
+		t.Fatal("the coinbase transactions of two blocks have the same ID")
+	}
+}
+
+// Run with -race: miners, balance queries and iterators use the same blockchain
+func TestConcurrentMiningAndReads(t *testing.T) {
+	chain := newTestChain(t)
+
+	const miners, blocksPerMiner = 4, 5
+	last := miners * blocksPerMiner
+
+	//Balance of the miner after each height: a query must see the UTXO set of a single last block
+	balances := make(map[Amount]bool)
+	var balance Amount
+	for height := 1; height <= last; height++ {
+		balances[balance] = true
+		balance += Amount(chain.Params.Reward(height))
+	}
+	balances[balance] = true
+
+	var mining, reading sync.WaitGroup
+	done := make(chan struct{})
+
+	for i := 0; i < miners; i++ {
+		mining.Add(1)
+		go func() {
+			defer mining.Done()
+
+			for j := 0; j < blocksPerMiner; j++ {
+				chain.AddBlock("miner", nil)
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		reading.Add(1)
+		go func(balanceQueries bool) {
+			defer reading.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				if balanceQueries {
+					var got Amount
+					for _, out := range (UTXOSet{chain}).FindUTXO("miner") {
+						got += out.Value
+					}
+
+					if balances[got] == false {
+						t.Errorf("balance %s isn't the balance at any height", got)
+						return
+					}
+
+					continue
+				}
+
+				//Every block down to the Genesis block, one height at a time
+				iter := chain.Iterator()
+				height := -1
+				for block := iter.Next(); block != nil; block = iter.Next() {
+					if height != -1 && block.Height != height-1 {
+						t.Errorf("the iterator went from height %d to %d", height, block.Height)
+						return
+					}
+					height = block.Height
+				}
+
+				if iter.Err() != nil || height != 0 {
+					t.Errorf("the iteration stopped at height %d: %v", height, iter.Err())
+					return
+				}
+			}
+		}(i%2 == 0)
+	}
+
+	mining.Wait()
+	close(done)
+	reading.Wait()
+
+	block, err := chain.GetBlock(chain.LastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Height != last {
+		t.Fatalf("the last block has height %d, want %d", block.Height, last)
+	}
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	chain := newTestChain(t)
+
+	params := *chain.Params
+	params.CoinbaseMaturity = 2
+	chain.Params = &params
+
+	payment := spendGenesis(t, chain, 1)
+
+	for height, mature := range map[int]bool{1: false, 2: true} {
+		err := chain.ValidateTransactions([]*Transaction{CoinbaseTx("miner", "", 1), payment}, height)
+		if (err == nil) != mature {
+			t.Errorf("spending the Genesis coinbase at height %d: %v", height, err)
+		}
+	}
+}
+
+func TestRelativeLock(t *testing.T) {
+	chain := newTestChain(t)
+
+	locked, _ := NewPaymentsTransaction("alice", nil, []Payment{{Address: "bob", Amount: 5000, RelativeLock: 3}}, nil, chain)
+	chain.AddBlock("miner", []*Transaction{locked}) //Confirmed at height 1
+
+	spend := func(sequence int) *Transaction {
+		tx := &Transaction{
+			Inputs:  []TxInput{{ID: locked.ID, Out: 0, Sig: "bob", Sequence: sequence}},
+			Outputs: []TxOutput{{Value: 5000, PubKey: "carol"}},
+		}
+		tx.SetID()
+
+		return tx
+	}
+
+	tests := []struct {
+		sequence int
+		height   int
+		valid    bool
+	}{
+		{3, 3, false}, //Only 2 blocks since the confirmation
+		{3, 4, true},
+		{5, 4, false}, //The input waits longer than the lock
+		{5, 6, true},
+		{2, 6, false}, //The sequence doesn't cover the lock of the output
+	}
+
+	for _, test := range tests {
+		err := chain.ValidateTransactions([]*Transaction{CoinbaseTx("miner", "", 1), spend(test.sequence)}, test.height)
+		if (err == nil) != test.valid {
+			t.Errorf("sequence %d at height %d: %v, want valid %v", test.sequence, test.height, err, test.valid)
+		}
+	}
+
+	//The inputs built by NewTransaction commit to the lock of the outputs they spend
+	chain.AddBlock("miner", nil)
+	chain.AddBlock("miner", nil)
+
+	tx := NewTransaction("bob", nil, "carol", 5000, 0, chain)
+	if tx.Inputs[0].Sequence != 3 {
+		t.Fatalf("the input has the sequence %d, want the lock of the output (3)", tx.Inputs[0].Sequence)
+	}
+	if err := chain.ValidateTransactions([]*Transaction{CoinbaseTx("miner", "", 1), tx}, chain.GetBestHeight()+1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDataOutputs(t *testing.T) {
+	chain := newTestChain(t)
+
+	withData := func(out TxOutput) *Transaction {
+		tx := spendGenesis(t, chain, 1)
+		tx.Outputs = append(tx.Outputs, out)
+		tx.SetID()
+
+		return tx
+	}
+
+	tests := []struct {
+		name  string
+		out   TxOutput
+		valid bool
+	}{
+		{"largest data", TxOutput{Data: bytes.Repeat([]byte{1}, MaxDataSize)}, true},
+		{"too much data", TxOutput{Data: bytes.Repeat([]byte{1}, MaxDataSize+1)}, false},
+		{"data holding tokens", TxOutput{Value: 1, Data: []byte("hello")}, false},
+		{"no tokens and no data", TxOutput{PubKey: "bob"}, false},
+	}
+
+	for _, test := range tests {
+		err := chain.ValidateTransactions([]*Transaction{CoinbaseTx("miner", "", 1), withData(test.out)}, 1)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+
+	//A mined data output can be found but never enters the UTXO set
+	tx := NewDataTransaction("alice", []byte("hello"), chain)
+	block := chain.AddBlock("miner", []*Transaction{tx})
+
+	found, err := chain.FindData([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(found.Hash, block.Hash) {
+		t.Fatalf("the data is in block %x, want %x", found.Hash, block.Hash)
+	}
+
+	UTXOSet := UTXOSet{chain}
+	if _, _, found := UTXOSet.FindOutput(tx.ID, 0); found {
+		t.Fatal("the data output is in the UTXO set")
+	}
+	if _, _, found := UTXOSet.FindOutput(tx.ID, 1); !found {
+		t.Fatal("the change of the data transaction isn't in the UTXO set")
+	}
+}
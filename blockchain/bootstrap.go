@@ -0,0 +1,243 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pierobassa/golang-blockchain/network"
+)
+
+/*
+A bootstrap file holds the blocks of the active chain, from the Genesis block to the last block, so a new node can be started
+(or a backup restored) without copying the Badger directory:
+  - header: the magic bytes, the format version, the name of the network (1 byte of length + the name) and the number of blocks (8 bytes, big endian)
+  - every block: the length of the serialized block (4 bytes, big endian) followed by the serialized block
+*/
+var bootstrapMagic = []byte("GBBF")
+
+const (
+	bootstrapVersion  = 1
+	maxBootstrapBlock = 64 << 20 //Larger records can only come from a corrupted file
+)
+
+/*
+Reads the blocks of a bootstrap file
+  - Network: name of the network of the blocks
+  - Count: number of blocks in the file
+*/
+type BootstrapReader struct {
+	Network string
+	Count   int
+
+	r *bufio.Reader
+}
+
+/*
+Reads the header of a bootstrap file
+
+@returns: the reader positioned at the Genesis block or an error if 'r' isn't a bootstrap file
+*/
+func NewBootstrapReader(r io.Reader) (*BootstrapReader, error) {
+	br := &BootstrapReader{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(bootstrapMagic)+2)
+	if _, err := io.ReadFull(br.r, header); err != nil {
+		return nil, fmt.Errorf("not a bootstrap file: %v", err)
+	}
+
+	if bytes.Equal(header[:len(bootstrapMagic)], bootstrapMagic) == false {
+		return nil, errors.New("not a bootstrap file")
+	}
+
+	if version := header[len(bootstrapMagic)]; version != bootstrapVersion {
+		return nil, fmt.Errorf("unsupported bootstrap file version %d", version)
+	}
+
+	name := make([]byte, header[len(bootstrapMagic)+1])
+	if _, err := io.ReadFull(br.r, name); err != nil {
+		return nil, fmt.Errorf("truncated bootstrap file: %v", err)
+	}
+	br.Network = string(name)
+
+	var count uint64
+	if err := binary.Read(br.r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("truncated bootstrap file: %v", err)
+	}
+	br.Count = int(count)
+
+	return br, nil
+}
+
+/*
+@returns: the next block of the file, io.EOF after the last block or an error if the file is truncated or corrupted
+*/
+func (br *BootstrapReader) Next() (*Block, error) {
+	var length uint32
+
+	err := binary.Read(br.r, binary.BigEndian, &length)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("truncated bootstrap file: %v", err)
+	}
+
+	if length == 0 || length > maxBootstrapBlock {
+		return nil, fmt.Errorf("corrupted bootstrap file: invalid block length %d", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(br.r, data); err != nil {
+		return nil, fmt.Errorf("truncated bootstrap file: %v", err)
+	}
+
+	var block Block
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&block); err != nil {
+		return nil, fmt.Errorf("corrupted bootstrap file: %v", err)
+	}
+
+	return &block, nil
+}
+
+/*
+Writes the active chain, from the Genesis block to the last block at the time of the call, as a bootstrap file.
+'progress' (optional) is called after every written block
+
+@returns: the number of written blocks
+*/
+func (chain *Blockchain) Export(w io.Writer, progress func(written, total int)) (int, error) {
+	iter := chain.ForwardIterator()
+	total := iter.end + 1
+
+	bw := bufio.NewWriter(w)
+
+	header := append(append([]byte{}, bootstrapMagic...), bootstrapVersion, byte(len(chain.Params.Name)))
+	header = append(header, chain.Params.Name...)
+	header = binary.BigEndian.AppendUint64(header, uint64(total))
+
+	if _, err := bw.Write(header); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		data := block.Serialize()
+
+		if _, err := bw.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data)))); err != nil {
+			return written, err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return written, err
+		}
+
+		written++
+		if progress != nil {
+			progress(written, total)
+		}
+	}
+	if iter.Err() != nil {
+		return written, iter.Err()
+	}
+
+	return written, bw.Flush()
+}
+
+/*
+Checks the Genesis block read from a bootstrap file before a blockchain is created with it:
+proof of work, hash and transaction IDs. Its outputs (ex: a premine) aren't bound to the reward schedule
+*/
+func ValidateGenesis(genesis *Block, params *network.ChainParams) error {
+	chain := &Blockchain{Params: params}
+
+	err := chain.verifyBlock(genesis, 0, nil, VerifyTransactions, nil)
+	if err != nil {
+		return fmt.Errorf("invalid Genesis block %x: %v", genesis.Hash, err)
+	}
+
+	return nil
+}
+
+/*
+Connects the blocks of a bootstrap file on top of the blockchain.
+Every block is validated like in VerifyChain (proof of work, link, checkpoints, transaction IDs and transaction rules) and written
+with the indexes in its own atomic batch, so an interrupted import can be resumed with the same file:
+the blocks that are already in the blockchain are only compared with the stored ones and skipped.
+'progress' (optional) is called after every block of the file
+
+@returns: the number of connected blocks and the error that stopped the import
+*/
+func (chain *Blockchain) Import(br *BootstrapReader, progress func(height, total int)) (int, error) {
+	if br.Network != chain.Params.Name {
+		return 0, fmt.Errorf("the bootstrap file is for the %s network, not %s", br.Network, chain.Params.Name)
+	}
+
+	heightIndex := HeightIndex{chain}
+	imported := 0
+
+	for {
+		block, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+
+		if block.Height <= chain.GetBestHeight() { //Already imported (or the Genesis block the blockchain was created with)
+			hash, err := heightIndex.GetHash(block.Height)
+			if err != nil {
+				return imported, err
+			}
+
+			if bytes.Equal(hash, block.Hash) == false {
+				return imported, fmt.Errorf("block %d of the file (%x) differs from the block of the blockchain (%x)", block.Height, block.Hash, hash)
+			}
+		} else {
+			err = chain.ImportBlock(block)
+			if err != nil {
+				return imported, err
+			}
+			imported++
+		}
+
+		if progress != nil {
+			progress(block.Height, br.Count)
+		}
+	}
+
+	return imported, nil
+}
+
+/*
+Validates a block that was mined elsewhere and connects it on top of the last block.
+Blocks marked invalid (see InvalidateBlock) are refused
+
+@returns: an error describing why the block can't be connected
+*/
+func (chain *Blockchain) ImportBlock(block *Block) error {
+	chain.writeMu.Lock()
+	defer chain.writeMu.Unlock()
+
+	if chain.IsInvalid(block.Hash) {
+		return fmt.Errorf("block %d (%x): %w", block.Height, block.Hash, ErrInvalidBlock)
+	}
+
+	lastBlock, err := chain.Database.GetBlock(chain.LastHash())
+	if err != nil {
+		return err
+	}
+
+	UTXOSet := UTXOSet{chain}
+
+	err = chain.verifyBlock(block, lastBlock.Height+1, lastBlock.Hash, VerifyTransactions, UTXOSet.FindOutput)
+	if err != nil {
+		return fmt.Errorf("block %d (%x): %w", block.Height, block.Hash, err)
+	}
+
+	return chain.connectBlock(block)
+}
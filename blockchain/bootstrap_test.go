@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+An import interrupted in the middle of the file (here a truncated file, like a copy that didn't complete) keeps the blocks
+connected so far, and importing the whole file in the reopened blockchain connects only the missing ones
+*/
+func TestImportResumesAfterAnInterruption(t *testing.T) {
+	source := newTestChain(t)
+	source.AddBlock("miner", []*Transaction{NewTransaction("alice", nil, "bob", 300, 0, source)})
+	source.AddBlock("miner", []*Transaction{NewTransaction("bob", nil, "carol", 100, 0, source)})
+	source.AddBlock("miner", nil)
+	source.AddBlock("miner", []*Transaction{NewTransaction("alice", nil, "carol", 50, 0, source)})
+
+	var file bytes.Buffer
+	if _, err := source.Export(&file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis, err := source.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	store, err := OpenBadgerStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := NewBlockchain(store, genesis, source.Params)
+	if err != nil {
+		store.Close()
+		t.Fatal(err)
+	}
+
+	br, err := NewBootstrapReader(bytes.NewReader(file.Bytes()[:file.Len()-10])) //The last block is cut
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := chain.Import(br, nil)
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("Import() of a truncated file = %v, want a truncated file error", err)
+	}
+	if imported != 3 || chain.GetBestHeight() != 3 {
+		t.Fatalf("%d blocks imported up to height %d, want 3", imported, chain.GetBestHeight())
+	}
+	if err := chain.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenBadgerStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err = LoadBlockchain(store, source.Params)
+	if err != nil {
+		store.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Close() })
+
+	br, err = NewBootstrapReader(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var heights []int
+	imported, err = chain.Import(br, func(height, total int) {
+		if total != 5 {
+			t.Errorf("progress with %d blocks in total, want 5", total)
+		}
+		heights = append(heights, height)
+	})
+	if err != nil || imported != 1 {
+		t.Fatalf("Import() = %d, %v, want the last block", imported, err)
+	}
+	if !reflect.DeepEqual(heights, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("progress reported the heights %v, want every block of the file", heights)
+	}
+
+	if !reflect.DeepEqual(chainState(t, chain), chainState(t, source)) {
+		t.Fatal("the imported blockchain differs from the exported one")
+	}
+	if problems := chain.CheckConsistency(); len(problems) > 0 {
+		t.Fatalf("inconsistent after the import: %q", problems)
+	}
+}
+
+func TestImportRefusesAnotherChain(t *testing.T) {
+	source := newTestChain(t)
+	source.AddBlock("miner", nil)
+	source.AddBlock("miner", nil)
+
+	other := newEmptyCopy(t, source)
+	other.AddBlock("mallory", nil)
+
+	imported, err := other.Import(exportChain(t, source), nil)
+	if err == nil || !strings.Contains(err.Error(), "differs") {
+		t.Fatalf("Import() of another chain = %v, want an error", err)
+	}
+	if imported != 0 {
+		t.Fatalf("%d blocks of another chain imported", imported)
+	}
+}
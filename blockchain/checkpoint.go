@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+Checkpoints (network.ChainParams.Checkpoints) pin the hash of the block at some heights: a chain that doesn't go through them
+is rejected whatever its proof of work, so a long fake chain can't replace the published one.
+The assumed-valid block (network.ChainParams.AssumeValid at AssumeValidHeight) must be one of the checkpoints: it and its ancestors are on the
+published chain, so their inputs aren't checked against the outputs they unlock (see assumedValid).
+The other rules (amounts, double spends, locks, rewards) are still checked
+*/
+
+// Returned when a block has another hash than the checkpoint at its height
+var ErrCheckpoint = errors.New("the block conflicts with a checkpoint")
+
+/*
+@returns: ErrCheckpoint (wrapped) if there's a checkpoint at the height of the block and the block has another hash
+*/
+func (chain *Blockchain) checkCheckpoint(block *Block) error {
+	checkpoint, found := chain.Params.Checkpoints[block.Height]
+	if found && checkpoint != hex.EncodeToString(block.Hash) {
+		return fmt.Errorf("%w: the block at height %d must be %s", ErrCheckpoint, block.Height, checkpoint)
+	}
+
+	return nil
+}
+
+/*
+@returns: the height of the assumed-valid block and false if there's none (AssumeValid is empty or isn't the checkpoint at AssumeValidHeight)
+*/
+func (chain *Blockchain) assumeValidHeight() (int, bool) {
+	height := chain.Params.AssumeValidHeight
+
+	if chain.Params.AssumeValid == "" || chain.Params.Checkpoints[height] != chain.Params.AssumeValid {
+		return 0, false
+	}
+
+	return height, true
+}
+
+/*
+The inputs of a block aren't checked against the outputs they unlock only when the block is the assumed-valid block or one of
+its ancestors: either one of the blocks read from a bootstrap file by FindAssumeValid, or a block of the active chain when the
+active chain goes through the assumed-valid block (ex: when the blockchain is verified).
+A block at the same height on another branch, or mined with AddBlock, is always fully checked
+
+@returns: true if the block is the assumed-valid block or one of its ancestors
+*/
+func (chain *Blockchain) assumedValid(block *Block) bool {
+	assumeValidHeight, found := chain.assumeValidHeight()
+	if !found || block.Height > assumeValidHeight {
+		return false
+	}
+
+	chain.mu.RLock()
+	known := chain.assumeValidAncestors[string(block.Hash)]
+	chain.mu.RUnlock()
+
+	if known {
+		return true
+	}
+
+	heightIndex := HeightIndex{chain}
+
+	assumeValidHash, err := heightIndex.GetHash(assumeValidHeight)
+	if err != nil || hex.EncodeToString(assumeValidHash) != chain.Params.AssumeValid {
+		return false
+	}
+
+	hash, err := heightIndex.GetHash(block.Height)
+
+	return err == nil && bytes.Equal(hash, block.Hash)
+}
+
+/*
+Reads a bootstrap file up to the height of the assumed-valid block and remembers the hashes of the assumed-valid block and of
+its ancestors, following the previous hashes back from it. The hash of every block is checked against its content, so a block
+of the file that only claims to be an ancestor isn't trusted. Import then skips the unlock checks of these blocks only
+
+@returns: the number of blocks found (0 if there's no assumed-valid block or the file doesn't contain it)
+*/
+func (chain *Blockchain) FindAssumeValid(br *BootstrapReader) (int, error) {
+	assumeValidHeight, found := chain.assumeValidHeight()
+	if !found {
+		return 0, nil
+	}
+
+	if br.Network != chain.Params.Name {
+		return 0, fmt.Errorf("the bootstrap file is for the %s network, not %s", br.Network, chain.Params.Name)
+	}
+
+	prevHashes := make(map[string][]byte) //Hash => previous hash of the blocks whose hash matches their content
+
+	for {
+		block, err := br.Next()
+		if err == io.EOF || (err == nil && block.Height > assumeValidHeight) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		pow := NewProof(block, chain.Params.Difficulty)
+		hash := sha256.Sum256(pow.InitData(block.Nonce))
+
+		if bytes.Equal(hash[:], block.Hash) {
+			prevHashes[string(block.Hash)] = block.PrevHash
+		}
+	}
+
+	assumeValidHash, err := hex.DecodeString(chain.Params.AssumeValid)
+	if err != nil {
+		return 0, fmt.Errorf("invalid assumed-valid hash: %v", err)
+	}
+
+	ancestors := make(map[string]bool)
+	for hash := assumeValidHash; len(hash) > 0; {
+		prevHash, found := prevHashes[string(hash)]
+		if !found {
+			break
+		}
+
+		ancestors[string(hash)] = true
+		hash = prevHash
+	}
+
+	if ancestors[string(assumeValidHash)] == false {
+		return 0, nil
+	}
+
+	chain.mu.Lock()
+	chain.assumeValidAncestors = ancestors
+	chain.mu.Unlock()
+
+	return len(ancestors), nil
+}
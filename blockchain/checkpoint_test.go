@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+/*
+Chain whose block 1 has a transaction that can't unlock the output it spends (mallory spends the reward of alice),
+connected without validation. Block 2, on top of it, is the assumed-valid block of the returned parameters
+
+@returns: the chain (with the parameters) and block 1
+*/
+func newAssumeValidChain(t *testing.T) (*Blockchain, *Block) {
+	t.Helper()
+
+	chain := newTestChain(t)
+
+	payment := spendGenesis(t, chain, Amount(chain.Params.Reward(1)))
+	payment.Inputs[0].Sig = "mallory"
+	payment.SetID()
+
+	coinbase := CoinbaseTx("miner", "block 1", Amount(chain.Params.Reward(1)))
+	block := CreateBlock([]*Transaction{coinbase, payment}, chain.LastHash(), 1, chain.Params.Difficulty)
+
+	chain.writeMu.Lock()
+	err := chain.connectBlock(block)
+	chain.writeMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assumeValid := hex.EncodeToString(chain.AddBlock("miner", nil).Hash)
+
+	params := *chain.Params
+	params.Checkpoints = map[int]string{2: assumeValid}
+	params.AssumeValid, params.AssumeValidHeight = assumeValid, 2
+	chain.Params = &params
+
+	return chain, block
+}
+
+/*
+Blockchain with the Genesis block and the parameters of 'source'
+*/
+func newEmptyCopy(t *testing.T, source *Blockchain) *Blockchain {
+	t.Helper()
+
+	genesis, err := source.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := NewBlockchain(NewMemoryStore(), genesis, source.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return chain
+}
+
+func exportChain(t *testing.T, chain *Blockchain) *BootstrapReader {
+	t.Helper()
+
+	var file bytes.Buffer
+	if _, err := chain.Export(&file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := NewBootstrapReader(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return br
+}
+
+func TestImportSkipsOnlyAncestorsOfAssumeValid(t *testing.T) {
+	source, _ := newAssumeValidChain(t)
+
+	chain := newEmptyCopy(t, source)
+	found, err := chain.FindAssumeValid(exportChain(t, source))
+	if err != nil || found != 3 {
+		t.Fatalf("FindAssumeValid() = %d, %v, want the 3 blocks up to the assumed-valid block", found, err)
+	}
+
+	imported, err := chain.Import(exportChain(t, source), nil)
+	if err != nil || imported != 2 {
+		t.Fatalf("Import() = %d, %v, want 2 blocks", imported, err)
+	}
+
+	//The active chain goes through the assumed-valid block
+	report, err := chain.VerifyChain(0, VerifyTransactions)
+	if err != nil || report.Problem != nil {
+		t.Fatalf("VerifyChain() = %+v, %v", report, err)
+	}
+
+	//Without the file the blocks aren't known to be ancestors of the assumed-valid block
+	unknown := newEmptyCopy(t, source)
+
+	imported, err = unknown.Import(exportChain(t, source), nil)
+	if err == nil || imported != 0 {
+		t.Fatalf("Import() without FindAssumeValid = %d, %v, want an error at block 1", imported, err)
+	}
+}
+
+func TestForksAreNotAssumedValid(t *testing.T) {
+	source, block := newAssumeValidChain(t)
+
+	chain := newEmptyCopy(t, source)
+	if _, err := chain.FindAssumeValid(exportChain(t, source)); err != nil {
+		t.Fatal(err)
+	}
+
+	//Same transactions, another block at the same height
+	fork := CreateBlock([]*Transaction{CoinbaseTx("miner", "fork", 1), block.Transactions[1]}, block.PrevHash, 1, chain.Params.Difficulty)
+	if err := chain.ImportBlock(fork); err == nil {
+		t.Fatal("a fork below the assumed-valid block was connected without checking its inputs")
+	}
+
+	//Mined blocks are always fully checked
+	coinbase := CoinbaseTx("miner", "mined", 1)
+	if err := chain.ValidateTransactions([]*Transaction{coinbase, block.Transactions[1]}, 1); err == nil {
+		t.Fatal("a mined block below the assumed-valid block was accepted without checking its inputs")
+	}
+
+	if err := chain.ImportBlock(block); err != nil {
+		t.Fatalf("the ancestor of the assumed-valid block was refused: %v", err)
+	}
+}
+
+func TestVerifyChainOffTheAssumeValidChain(t *testing.T) {
+	source, _ := newAssumeValidChain(t)
+
+	//An assumed-valid block that isn't on the active chain doesn't vouch for its blocks
+	params := *source.Params
+	params.AssumeValid, params.AssumeValidHeight = hex.EncodeToString(bytes.Repeat([]byte{1}, 32)), 2
+	params.Checkpoints = map[int]string{2: params.AssumeValid}
+	source.Params = &params
+
+	report, err := source.VerifyChain(0, VerifyTransactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Problem == nil {
+		t.Fatal("the invalid input of block 1 wasn't reported")
+	}
+}
@@ -0,0 +1,241 @@
+package blockchain
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+/*
+An unspent output that can be used as an input of a new transaction
+*/
+type SpendableOutput struct {
+	TxID   []byte
+	Index  int
+	Output TxOutput
+	Height int //Height of the block that confirmed the output
+}
+
+/*
+A coin selection strategy picks which spendable outputs pay for a transaction.
+Select returns outputs worth at least 'amount' tokens or an error if the candidates are not enough.
+*/
+type CoinSelector interface {
+	Select(candidates []SpendableOutput, amount Amount) ([]SpendableOutput, error)
+}
+
+var ErrInsufficientFunds = errors.New("not enough funds")
+
+/*
+Returns the strategy with the given name: "largest", "smallest", "bnb" (branch and bound) or "random"
+*/
+func NewCoinSelector(name string) (CoinSelector, error) {
+	switch name {
+	case "largest":
+		return LargestFirst{}, nil
+	case "smallest":
+		return SmallestFirst{}, nil
+	case "bnb":
+		return BranchAndBound{}, nil
+	case "random":
+		return RandomSelector{}, nil
+	}
+
+	return nil, errors.New("unknown coin selection strategy " + name)
+}
+
+/*
+Cost of creating a change output: a new output to store in the UTXO set and to spend later, linking the coins of a wallet together.
+With BranchAndBound an excess up to ChangeCost is left to the miner as a fee instead (see NewPaymentsTransaction)
+*/
+const ChangeCost Amount = 1000
+
+/*
+The waste of a selection measures how far it is from an exact match, in tokens, when an excess up to ChangeCost is left to the miner:
+  - excess up to ChangeCost: no change output, the whole excess is waste (it pays the miner instead of the recipients)
+  - excess above ChangeCost: the excess comes back as a change output, the waste is the cost of that output (ChangeCost)
+
+An exact match has no waste.
+*/
+func Waste(selected []SpendableOutput, amount Amount) Amount {
+	excess := totalValue(selected) - amount
+	if excess > ChangeCost {
+		return ChangeCost
+	}
+
+	return excess
+}
+
+/*
+Tells if an excess up to ChangeCost of the selections of 'selector' is left to the miner.
+Only BranchAndBound looks for selections without change, the other strategies give any excess back as a change output
+*/
+func leavesExcessToMiner(selector CoinSelector) bool {
+	switch selector.(type) {
+	case BranchAndBound, *BranchAndBound:
+		return true
+	}
+
+	return false
+}
+
+/*
+Waste of a selection made by 'selector': a selection with a change output wastes ChangeCost (see Waste)
+*/
+func selectionWaste(selected []SpendableOutput, amount Amount, selector CoinSelector) Amount {
+	if leavesExcessToMiner(selector) {
+		return Waste(selected, amount)
+	}
+
+	if totalValue(selected) == amount {
+		return 0
+	}
+
+	return ChangeCost
+}
+
+/* --------------- STRATEGIES --------------- */
+
+/*
+Spends the biggest outputs first: few inputs, but big change outputs
+*/
+type LargestFirst struct{}
+
+func (LargestFirst) Select(candidates []SpendableOutput, amount Amount) ([]SpendableOutput, error) {
+	sorted := append([]SpendableOutput{}, candidates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Output.Value > sorted[j].Output.Value })
+
+	return accumulate(sorted, amount)
+}
+
+/*
+Spends the smallest outputs first: consolidates dust, but uses many inputs
+*/
+type SmallestFirst struct{}
+
+func (SmallestFirst) Select(candidates []SpendableOutput, amount Amount) ([]SpendableOutput, error) {
+	sorted := append([]SpendableOutput{}, candidates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Output.Value < sorted[j].Output.Value })
+
+	return accumulate(sorted, amount)
+}
+
+/*
+Spends random outputs so the selection doesn't reveal which coins belong together
+*/
+type RandomSelector struct{}
+
+func (RandomSelector) Select(candidates []SpendableOutput, amount Amount) ([]SpendableOutput, error) {
+	shuffled := append([]SpendableOutput{}, candidates...)
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	random.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	return accumulate(shuffled, amount)
+}
+
+/*
+Searches (depth first) for the set of outputs with the least waste (see Waste) that needs no change output:
+its value is between the amount and the amount plus ChangeCost. The search stops at an exact match.
+If there's no such set within MaxTries steps the Fallback strategy is used (LargestFirst when nil)
+*/
+type BranchAndBound struct {
+	MaxTries int //0 means 100000
+	Fallback CoinSelector
+}
+
+func (bnb BranchAndBound) Select(candidates []SpendableOutput, amount Amount) ([]SpendableOutput, error) {
+	maxTries := bnb.MaxTries
+	if maxTries == 0 {
+		maxTries = 100000
+	}
+
+	sorted := append([]SpendableOutput{}, candidates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Output.Value > sorted[j].Output.Value })
+
+	//remaining[i] is the value of all the outputs from i onwards, used to prune the branches that can't reach the amount
+	remaining := make([]Amount, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Output.Value
+	}
+
+	tries := 0
+	var selected, best []SpendableOutput
+	bestWaste := ChangeCost + 1
+
+	var search func(i int, current Amount) bool
+	search = func(i int, current Amount) bool {
+		tries++
+
+		if current >= amount { //Adding outputs would only increase the waste
+			if current-amount < bestWaste {
+				best = append([]SpendableOutput{}, selected...)
+				bestWaste = current - amount
+			}
+
+			return bestWaste == 0
+		}
+		if i == len(sorted) || current+remaining[i] < amount || tries > maxTries {
+			return false
+		}
+
+		//Branch 1: include the output
+		selected = append(selected, sorted[i])
+		if search(i+1, current+sorted[i].Output.Value) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+
+		//Branch 2: skip the output
+		return search(i+1, current)
+	}
+
+	search(0, 0)
+
+	if best != nil {
+		return best, nil
+	}
+
+	fallback := bnb.Fallback
+	if fallback == nil {
+		fallback = LargestFirst{}
+	}
+
+	return fallback.Select(candidates, amount)
+}
+
+/*
+Takes the outputs in order until the amount is covered
+*/
+func accumulate(ordered []SpendableOutput, amount Amount) ([]SpendableOutput, error) {
+	var selected []SpendableOutput
+	var accumulated Amount
+
+	for _, candidate := range ordered {
+		if accumulated >= amount {
+			break
+		}
+
+		selected = append(selected, candidate)
+		accumulated += candidate.Output.Value
+	}
+
+	if accumulated < amount {
+		return nil, ErrInsufficientFunds
+	}
+
+	return selected, nil
+}
+
+/*
+The outputs come from the UTXO set where every amount has been validated, and the total supply fits in an Amount
+*/
+func totalValue(outputs []SpendableOutput) Amount {
+	var total Amount
+	for _, out := range outputs {
+		total += out.Output.Value
+	}
+
+	return total
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import "testing"
+
+func outputsOf(values ...Amount) []SpendableOutput {
+	var outputs []SpendableOutput
+	for i, value := range values {
+		outputs = append(outputs, SpendableOutput{TxID: []byte{byte(i)}, Output: TxOutput{Value: value}})
+	}
+
+	return outputs
+}
+
+func TestWaste(t *testing.T) {
+	tests := []struct {
+		values []Amount
+		want   Amount
+	}{
+		{[]Amount{5000}, 0},                       //Exact match
+		{[]Amount{5010}, 10},                      //No change output: the excess pays the miner
+		{[]Amount{5000 + ChangeCost}, ChangeCost}, //Largest excess without change
+		{[]Amount{9000}, ChangeCost},              //Change output
+	}
+
+	for _, test := range tests {
+		if got := Waste(outputsOf(test.values...), 5000); got != test.want {
+			t.Errorf("Waste(%v, 5000) = %s, want %s", test.values, got, test.want)
+		}
+	}
+}
+
+func TestBranchAndBoundLeastWaste(t *testing.T) {
+	tests := []struct {
+		candidates []Amount
+		want       Amount //Total of the selection
+	}{
+		{[]Amount{7000, 3000, 2000, 1000}, 5000}, //Exact match
+		{[]Amount{7000, 3000, 2050, 2010}, 5010}, //Least excess below ChangeCost
+		{[]Amount{9000, 3000, 1000}, 9000},       //No selection without change: LargestFirst
+	}
+
+	for _, test := range tests {
+		selected, err := BranchAndBound{}.Select(outputsOf(test.candidates...), 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := totalValue(selected); got != test.want {
+			t.Errorf("BranchAndBound.Select(%v, 5000) spends %s, want %s", test.candidates, got, test.want)
+		}
+
+		//The selection never wastes more than any other strategy
+		largest, _ := LargestFirst{}.Select(outputsOf(test.candidates...), 5000)
+		if Waste(selected, 5000) > Waste(largest, 5000) {
+			t.Errorf("BranchAndBound.Select(%v, 5000) wastes more than LargestFirst", test.candidates)
+		}
+	}
+}
+
+func TestOnlyBranchAndBoundLeavesTheExcessToTheMiner(t *testing.T) {
+	tests := []struct {
+		selector CoinSelector
+		outputs  int //Payment + change
+		waste    Amount
+	}{
+		{nil, 2, ChangeCost},
+		{LargestFirst{}, 2, ChangeCost},
+		{SmallestFirst{}, 2, ChangeCost},
+		{BranchAndBound{}, 1, 10},
+	}
+
+	for _, test := range tests {
+		chain := newTestChain(t)
+		reward := Amount(chain.Params.Reward(0))
+
+		tx, waste := NewPaymentsTransaction("alice", nil, []Payment{{Address: "bob", Amount: reward - 10}}, test.selector, chain)
+
+		if len(tx.Outputs) != test.outputs || waste != test.waste {
+			t.Errorf("%T: %d outputs and waste %s, want %d outputs and waste %s", test.selector, len(tx.Outputs), waste, test.outputs, test.waste)
+		}
+	}
+}
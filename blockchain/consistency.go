@@ -0,0 +1,79 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/*
+The UTXO set and the indexes are updated in the same batch that connects a block (see AddBlock), so they always reflect the tip.
+The hash of the block they reflect is stored next to the tip: it's removed while an index is rebuilt and written back once the rebuild is complete.
+A rebuild interrupted by a crash (or a blockchain created before this key existed) is detected on startup and the indexes are rebuilt.
+*/
+var indexesTipKey = []byte("indexes-lh")
+
+func (chain *Blockchain) markIndexesStale() {
+	err := chain.Database.Update(func(batch Batch) error {
+		return batch.Delete(indexesTipKey)
+	})
+	Handle(err)
+}
+
+func (chain *Blockchain) markIndexesSynced() {
+	err := chain.Database.Update(func(batch Batch) error {
+		return batch.Set(indexesTipKey, chain.LastHash())
+	})
+	Handle(err)
+}
+
+/*
+Checks that the UTXO set and the indexes reflect the last block
+
+@returns: the problems found (empty when the blockchain is consistent)
+*/
+func (chain *Blockchain) CheckConsistency() []string {
+	var problems []string
+
+	lastHash := chain.LastHash()
+
+	indexesTip, err := chain.Database.Get(indexesTipKey)
+	switch {
+	case err == ErrNotFound:
+		problems = append(problems, "the indexes aren't marked as complete (interrupted rebuild or blockchain created by an older version)")
+	case err != nil:
+		Handle(err)
+	case bytes.Equal(indexesTip, lastHash) == false:
+		problems = append(problems, fmt.Sprintf("the indexes reflect block %x instead of the last block %x", indexesTip, lastHash))
+	}
+
+	heightIndex := HeightIndex{chain}
+	if heightIndex.IsSynced() == false {
+		problems = append(problems, "the height index doesn't end at the last block")
+	}
+
+	return problems
+}
+
+/*
+Rebuilds the UTXO set, the height index and the enabled optional indexes from the blocks
+*/
+func (chain *Blockchain) Repair() {
+	chain.writeMu.Lock()
+	defer chain.writeMu.Unlock()
+
+	UTXOSet := UTXOSet{chain}
+	UTXOSet.reindex()
+
+	heightIndex := HeightIndex{chain}
+	heightIndex.reindex()
+
+	txIndex := TxIndex{chain}
+	if txIndex.Enabled() {
+		txIndex.reindex()
+	}
+
+	addressIndex := AddressIndex{chain}
+	if addressIndex.Enabled() {
+		addressIndex.reindex()
+	}
+}
@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var errCrash = errors.New("crash")
+
+/*
+Store whose updates panic (like a process killed in the middle of a write) when they write a key starting with 'crashOn'
+*/
+type crashingStore struct {
+	Store
+	crashOn []byte
+}
+
+func (s *crashingStore) Update(fn func(batch Batch) error) error {
+	return s.Store.Update(func(batch Batch) error {
+		return fn(crashingBatch{batch, s.crashOn})
+	})
+}
+
+type crashingBatch struct {
+	Batch
+	crashOn []byte
+}
+
+func (b crashingBatch) Set(key, value []byte) error {
+	if bytes.HasPrefix(key, b.crashOn) {
+		panic(errCrash)
+	}
+
+	return b.Batch.Set(key, value)
+}
+
+func (b crashingBatch) SetTip(hash []byte) error {
+	return b.Set(tipKey, hash)
+}
+
+/*
+Runs 'fn' and checks that it crashed
+*/
+func crash(t *testing.T, fn func()) {
+	t.Helper()
+
+	defer func() {
+		if r := recover(); r != errCrash {
+			t.Fatalf("recovered %v, want the crash of the store", r)
+		}
+	}()
+
+	fn()
+}
+
+func TestRepairAfterCrash(t *testing.T) {
+	tests := []struct {
+		name         string
+		crashOn      []byte
+		crash        func(chain *Blockchain)
+		inconsistent bool //The crash leaves the indexes marked as out of sync
+	}{
+		{"while connecting a block", tipKey, func(chain *Blockchain) { chain.AddBlock("miner", nil) }, false},
+		{"while rebuilding the UTXO set", utxoPrefix, func(chain *Blockchain) { chain.Repair() }, true},
+		{"while rebuilding the height index", heightIndexPrefix, func(chain *Blockchain) { chain.Repair() }, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain := newTestChain(t)
+			TxIndex{chain}.Reindex()
+			AddressIndex{chain}.Reindex()
+
+			reward := Amount(chain.Params.Reward(1))
+			chain.AddBlock("miner", []*Transaction{spendGenesis(t, chain, reward-10)})
+
+			store := chain.Database
+			before := chainState(t, chain)
+
+			chain.Database = &crashingStore{store, test.crashOn}
+			crash(t, func() { test.crash(chain) })
+
+			chain.Database = store
+			if problems := chain.CheckConsistency(); (len(problems) > 0) != test.inconsistent {
+				t.Fatalf("CheckConsistency() after the crash = %q", problems)
+			}
+
+			//Started again: the last block is the one before the crash and the UTXO set and the indexes are rebuilt if needed
+			restarted, err := LoadBlockchain(store, chain.Params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if problems := restarted.CheckConsistency(); len(problems) > 0 {
+				t.Fatalf("inconsistent after the restart: %q", problems)
+			}
+
+			if after := chainState(t, restarted); reflect.DeepEqual(after, before) == false {
+				t.Errorf("the state after the restart isn't the one before the crash")
+			}
+
+			restarted.AddBlock("miner", nil)
+			if height := restarted.GetBestHeight(); height != 2 {
+				t.Errorf("GetBestHeight() = %d after a new block, want 2", height)
+			}
+		})
+	}
+}
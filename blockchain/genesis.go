@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pierobassa/golang-blockchain/network"
+	"github.com/pierobassa/golang-blockchain/wallet"
+)
+
+/*
+A genesis spec describes the Genesis block of a private deployment:
+  - Timestamp: Unix time of the Genesis block
+  - Message: data of the input of the coinbase transaction
+  - Allocations: initial tokens of every address, paid by the coinbase transaction in the same order
+
+Every field of the Genesis block comes from the spec (the nonce search always starts from 0),
+so every node that builds the Genesis block from the same spec gets the same hash.
+
+Example:
+
+	{
+	  "timestamp": 1700000000,
+	  "message": "Private network launch",
+	  "allocations": [
+	    {"address": "alice", "amount": "500"},
+	    {"address": "bob", "amount": "250.5", "lockTime": 1000}
+	  ]
+	}
+*/
+type GenesisSpec struct {
+	Timestamp   int64               `json:"timestamp"`
+	Message     string              `json:"message"`
+	Allocations []GenesisAllocation `json:"allocations"`
+}
+
+/*
+Initial tokens of an address
+  - Amount: in coins with up to 8 decimals (ex: "12.5")
+  - LockTime: vesting height, the tokens can't be spent in a block below it (0 means no vesting)
+*/
+type GenesisAllocation struct {
+	Address  string `json:"address"`
+	Amount   string `json:"amount"`
+	LockTime int    `json:"lockTime,omitempty"`
+}
+
+/*
+Reads a genesis spec from a JSON file
+*/
+func LoadGenesisSpec(path string) (*GenesisSpec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec GenesisSpec
+
+	err = json.Unmarshal(content, &spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis spec %s: %v", path, err)
+	}
+
+	return &spec, nil
+}
+
+/*
+Builds the coinbase transaction that pays the allocations of the spec
+*/
+func (spec *GenesisSpec) CoinbaseTx(params *network.ChainParams) (*Transaction, error) {
+	if len(spec.Allocations) == 0 {
+		return nil, errors.New("the genesis spec has no allocations")
+	}
+
+	if spec.Message == "" {
+		return nil, errors.New("the genesis spec has no message")
+	}
+
+	var outputs []TxOutput
+	var total Amount
+
+	for i, allocation := range spec.Allocations {
+		if allocation.Address == "" {
+			return nil, fmt.Errorf("allocation %d has no address", i)
+		}
+
+		amount, err := ParseAmount(allocation.Amount)
+		if err != nil || amount == 0 {
+			return nil, fmt.Errorf("allocation %d: invalid amount %q", i, allocation.Amount)
+		}
+
+		total, err = total.Add(amount)
+		if err != nil {
+			return nil, fmt.Errorf("allocations: %v", err)
+		}
+
+		if allocation.LockTime < 0 {
+			return nil, fmt.Errorf("allocation %d: the lock time can't be negative", i)
+		}
+
+		if err := wallet.CheckNetwork(allocation.Address, params); err != nil {
+			return nil, fmt.Errorf("allocation %d: %v", i, err)
+		}
+
+		output := NewTxOutput(amount, allocation.Address, 0, params)
+
+		if output.IsScriptHash() && allocation.LockTime > 0 { //The spend conditions of a P2SH output are in its redeem script
+			return nil, fmt.Errorf("allocation %d: pay-to-script-hash addresses can't have a lock time", i)
+		}
+		output.LockTime = allocation.LockTime
+
+		outputs = append(outputs, output)
+	}
+
+	txin := TxInput{ID: []byte{}, Out: -1, Sig: spec.Message}
+
+	tx := Transaction{nil, []TxInput{txin}, outputs}
+	tx.SetID()
+
+	return &tx, nil
+}
+
+/*
+Builds (and mines) the Genesis block of the spec
+*/
+func (spec *GenesisSpec) Block(params *network.ChainParams) (*Block, error) {
+	if spec.Timestamp <= 0 {
+		return nil, errors.New("the genesis spec has no timestamp")
+	}
+
+	coinbase, err := spec.CoinbaseTx(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return mineBlock([]*Transaction{coinbase}, []byte{}, 0, spec.Timestamp, params.Difficulty), nil
+}
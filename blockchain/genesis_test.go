@@ -0,0 +1,136 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pierobassa/golang-blockchain/network"
+	"github.com/pierobassa/golang-blockchain/wallet"
+)
+
+const testGenesisSpec = `{
+  "timestamp": 1700000000,
+  "message": "Private network launch",
+  "allocations": [
+    {"address": "alice", "amount": "500"},
+    {"address": "bob", "amount": "250.5", "lockTime": 3}
+  ]
+}`
+
+func loadTestGenesisSpec(t *testing.T) *GenesisSpec {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	if err := os.WriteFile(path, []byte(testGenesisSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := LoadGenesisSpec(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return spec
+}
+
+/*
+Every node builds the Genesis block from the spec on its own: the hash must only depend on the spec
+*/
+func TestGenesisSpecIsDeterministic(t *testing.T) {
+	const hash = "006ba759883de26a823d4dd26b3e0a058f6851f2c63b342a3bdad6b74f4a212d"
+
+	params := network.RegTest
+
+	for i := 0; i < 2; i++ {
+		genesis, err := loadTestGenesisSpec(t).Block(&params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := hex.EncodeToString(genesis.Hash); got != hash {
+			t.Fatalf("the Genesis block has hash %s, want %s", got, hash)
+		}
+	}
+
+	//Any change of the spec gives another Genesis block
+	spec := loadTestGenesisSpec(t)
+	spec.Allocations[1].LockTime = 4
+
+	genesis, err := spec.Block(&params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(genesis.Hash) == hash {
+		t.Fatal("changing the lock time of an allocation doesn't change the Genesis block")
+	}
+}
+
+func TestInvalidGenesisSpec(t *testing.T) {
+	params := network.RegTest
+	mainAddress := string(wallet.MakeWallet().Address(&network.MainNet))
+
+	tests := map[string]func(spec *GenesisSpec){
+		"no timestamp":             func(spec *GenesisSpec) { spec.Timestamp = 0 },
+		"no message":               func(spec *GenesisSpec) { spec.Message = "" },
+		"no allocations":           func(spec *GenesisSpec) { spec.Allocations = nil },
+		"no address":               func(spec *GenesisSpec) { spec.Allocations[0].Address = "" },
+		"zero amount":              func(spec *GenesisSpec) { spec.Allocations[0].Amount = "0" },
+		"negative amount":          func(spec *GenesisSpec) { spec.Allocations[0].Amount = "-1" },
+		"negative lock time":       func(spec *GenesisSpec) { spec.Allocations[1].LockTime = -1 },
+		"overflowing total":        func(spec *GenesisSpec) { spec.Allocations[0].Amount = "184467440737" },
+		"address of other network": func(spec *GenesisSpec) { spec.Allocations[0].Address = mainAddress },
+	}
+
+	for name, change := range tests {
+		spec := loadTestGenesisSpec(t)
+		change(spec)
+
+		if _, err := spec.Block(&params); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestGenesisVesting(t *testing.T) {
+	params := network.RegTest
+
+	genesis, err := loadTestGenesisSpec(t).Block(&params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := NewBlockchain(NewMemoryStore(), genesis, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := balance(chain, "bob"); got != 25050000000 {
+		t.Fatalf("bob has %s, want 250.5", got)
+	}
+
+	spend := &Transaction{
+		Inputs:  []TxInput{{ID: genesis.Transactions[0].ID, Out: 1, Sig: "bob"}},
+		Outputs: []TxOutput{{Value: 100, PubKey: "carol"}},
+	}
+	spend.SetID()
+
+	for height, vested := range map[int]bool{1: false, 2: false, 3: true} {
+		err := chain.ValidateTransactions([]*Transaction{CoinbaseTx("miner", "", 1), spend}, height)
+		if (err == nil) != vested {
+			t.Errorf("spending the allocation of bob at height %d: %v", height, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "vesting until height 3") {
+			t.Errorf("spending the allocation of bob at height %d: %v, want a vesting error", height, err)
+		}
+	}
+
+	//The allocation without lock time can be spent right away
+	spend.Inputs[0] = TxInput{ID: genesis.Transactions[0].ID, Out: 0, Sig: "alice"}
+	spend.SetID()
+	if err := chain.ValidateTransactions([]*Transaction{CoinbaseTx("miner", "", 1), spend}, 1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+The height index maps the height of every block of the active chain to its hash,
+so a block can be found without going backwards from the last hash.
+Connecting a block overwrites the hash at its height and disconnecting it removes the entry,
+so after a reorganization the index only contains the blocks of the new active chain.
+*/
+var heightIndexPrefix = []byte("h-")
+
+type HeightIndex struct {
+	Blockchain *Blockchain
+}
+
+/*
+Rebuilds the index going backwards from the last block and removes the entries above the last block.
+The indexes are marked as out of sync until the rebuild is complete (see Blockchain.Repair)
+*/
+func (idx HeightIndex) Reindex() {
+	idx.Blockchain.writeMu.Lock()
+	defer idx.Blockchain.writeMu.Unlock()
+
+	idx.reindex()
+}
+
+func (idx HeightIndex) reindex() {
+	idx.Blockchain.markIndexesStale()
+
+	err := idx.Blockchain.Database.DeleteByPrefix(heightIndexPrefix)
+	Handle(err)
+
+	iter := idx.Blockchain.headerIterator() //Only the hashes are needed, so the pruned blocks are indexed too
+
+	writer := chunkedWriter{store: idx.Blockchain.Database}
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		err := writer.Set(heightKey(block.Height), block.Hash)
+		Handle(err)
+	}
+	Handle(iter.Err())
+
+	err = writer.Flush()
+	Handle(err)
+
+	idx.Blockchain.markIndexesSynced()
+}
+
+/*
+Tells if the index is consistent with the last block of the blockchain
+*/
+func (idx HeightIndex) IsSynced() bool {
+	lastHeight := idx.Blockchain.GetBestHeight()
+
+	hash, err := idx.GetHash(lastHeight)
+	if err != nil {
+		return false
+	}
+
+	_, err = idx.GetHash(lastHeight + 1) //No entry must be left above the last block
+
+	return bytes.Equal(hash, idx.Blockchain.LastHash()) && err != nil
+}
+
+/*
+Adds a block as part of the batch that connects it
+*/
+func (idx HeightIndex) ConnectBlock(batch Batch, block *Block) {
+	err := batch.Set(heightKey(block.Height), block.Hash)
+	Handle(err)
+}
+
+/*
+Removes a block as part of the batch that disconnects it
+*/
+func (idx HeightIndex) DisconnectBlock(batch Batch, block *Block) {
+	err := batch.Delete(heightKey(block.Height))
+	Handle(err)
+}
+
+/*
+@returns: the hash of the block at 'height' in the active chain or an error if there's no such block
+*/
+func (idx HeightIndex) GetHash(height int) ([]byte, error) {
+	if height < 0 {
+		return nil, errors.New("the height can't be negative")
+	}
+
+	hash, err := idx.Blockchain.Database.Get(heightKey(height))
+	if err == ErrNotFound {
+		return nil, errors.New("no block at this height")
+	}
+
+	return hash, err
+}
+
+func heightKey(height int) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte{}, heightIndexPrefix...), uint64(height))
+}
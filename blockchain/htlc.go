@@ -0,0 +1,128 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log"
+)
+
+/*
+Atomic swaps between two independent blockchains are built on hash time-locked contracts (HTLC):
+
+ 1. The initiator creates a secret and locks tokens on chain A for the participant with the hash of the secret.
+    Only the participant with the secret can redeem them, the initiator can take them back after a timeout.
+ 2. The participant locks tokens on chain B for the initiator with the same hash and a shorter timeout.
+ 3. The initiator redeems the tokens on chain B revealing the secret.
+ 4. The participant extracts the secret from the redeem transaction and redeems the tokens on chain A.
+
+If anyone stops cooperating both can refund their contracts once the timeouts are reached.
+*/
+
+const SecretSize = 32
+
+/*
+Creates a random secret for an atomic swap
+
+@returns: the secret and its SHA256 hash (the hash lock of the contracts)
+*/
+func NewSecret() ([]byte, []byte) {
+	secret := make([]byte, SecretSize)
+
+	_, err := rand.Read(secret)
+	Handle(err)
+
+	hash := sha256.Sum256(secret)
+
+	return secret, hash[:]
+}
+
+/*
+Creates a transaction that locks 'amount' tokens of 'from' in an HTLC output (always at index 0)
+
+@param: to -> account that can redeem the tokens with the secret
+@param: hashLock -> SHA256 hash of the secret
+@param: timeout -> number of blocks after which 'from' can refund the tokens
+*/
+func NewHTLCTransaction(from, to string, amount Amount, hashLock []byte, timeout int, chain *Blockchain) *Transaction {
+	var outputs []TxOutput
+
+	if len(hashLock) != sha256.Size {
+		log.Panic("Error: the hash lock must be a SHA256 hash!")
+	}
+
+	inputs, accumulator, _ := spendInputs(from, nil, amount, nil, chain)
+
+	lockTime := chain.GetBestHeight() + 1 + timeout //The contract is confirmed in the next block
+
+	outputs = append(outputs, TxOutput{Value: amount, PubKey: to, HashLock: hashLock, Refund: from, LockTime: lockTime})
+
+	outputs = appendChange(outputs, from, accumulator-amount, nil, chain)
+
+	tx := Transaction{nil, inputs, outputs}
+	tx.SetID()
+
+	return &tx
+}
+
+/*
+Creates the transaction that redeems the HTLC output of 'contractID' revealing the secret. The tokens go to the recipient of the contract.
+*/
+func NewRedeemTransaction(contractID []byte, secret []byte, chain *Blockchain) *Transaction {
+	UTXOSet := UTXOSet{chain}
+
+	contract, _, found := UTXOSet.FindOutput(contractID, 0)
+	if !found || contract.IsHTLC() == false {
+		log.Panic("Error: contract not found or already spent!")
+	}
+
+	input := TxInput{ID: contractID, Out: 0, Sig: contract.PubKey, Preimage: secret}
+	if contract.CanRedeem(&input) == false {
+		log.Panic("Error: the secret doesn't match the hash lock of the contract!")
+	}
+
+	tx := Transaction{nil, []TxInput{input}, []TxOutput{{Value: contract.Value, PubKey: contract.PubKey}}}
+	tx.SetID()
+
+	return &tx
+}
+
+/*
+Creates the transaction that gives the tokens of the HTLC output of 'contractID' back to its sender once the timeout is reached
+*/
+func NewRefundTransaction(contractID []byte, chain *Blockchain) *Transaction {
+	UTXOSet := UTXOSet{chain}
+
+	contract, _, found := UTXOSet.FindOutput(contractID, 0)
+	if !found || contract.IsHTLC() == false {
+		log.Panic("Error: contract not found or already spent!")
+	}
+
+	input := TxInput{ID: contractID, Out: 0, Sig: contract.Refund}
+	if contract.CanRefund(&input, chain.GetBestHeight()+1) == false {
+		log.Panicf("Error: the contract can be refunded from height %d!", contract.LockTime)
+	}
+
+	tx := Transaction{nil, []TxInput{input}, []TxOutput{{Value: contract.Value, PubKey: contract.Refund}}}
+	tx.SetID()
+
+	return &tx
+}
+
+/*
+Extracts the secret from a transaction that redeemed an HTLC with the given hash lock
+
+@returns: the secret or an error if the transaction doesn't reveal it
+*/
+func ExtractSecret(tx *Transaction, hashLock []byte) ([]byte, error) {
+	for _, in := range tx.Inputs {
+		hash := sha256.Sum256(in.Preimage)
+
+		if len(in.Preimage) > 0 && bytes.Equal(hash[:], hashLock) {
+			return in.Preimage, nil
+		}
+	}
+
+	return nil, fmt.Errorf("transaction %x doesn't reveal the secret of hash %x", tx.ID, hashLock)
+}
@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pierobassa/golang-blockchain/network"
+)
+
+/*
+Blockchain in its own data directory whose Genesis block pays 'owner'
+*/
+func newSwapChain(t *testing.T, owner string) *Blockchain {
+	t.Helper()
+
+	store, err := OpenBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := network.RegTest
+
+	genesis := Genesis(CoinbaseTx(owner, params.GenesisData, Amount(params.Reward(0))), params.Difficulty)
+
+	chain, err := NewBlockchain(store, genesis, &params)
+	if err != nil {
+		store.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Close() })
+
+	return chain
+}
+
+func balance(chain *Blockchain, address string) Amount {
+	var total Amount
+	for _, out := range (UTXOSet{chain}).FindUTXO(address) {
+		total += out.Value
+	}
+
+	return total
+}
+
+func TestAtomicSwapBetweenTwoChains(t *testing.T) {
+	chainA := newSwapChain(t, "alice") //alice swaps tokens of chain A for tokens of bob on chain B
+	chainB := newSwapChain(t, "bob")
+
+	const amount Amount = 5000
+
+	//alice initiates on chain A, bob participates on chain B with the same secret hash and a shorter timeout
+	secret, hash := NewSecret()
+
+	contractA := NewHTLCTransaction("alice", "bob", amount, hash, 48, chainA)
+	chainA.AddBlock("alice", []*Transaction{contractA})
+
+	contractB := NewHTLCTransaction("bob", "alice", amount, hash, 24, chainB)
+	chainB.AddBlock("bob", []*Transaction{contractB})
+
+	//alice redeems on chain B, revealing the secret
+	redeemB := NewRedeemTransaction(contractB.ID, secret, chainB)
+	chainB.AddBlock("alice", []*Transaction{redeemB})
+
+	//bob finds the secret in the redeem transaction of chain B and redeems on chain A
+	found, err := chainB.FindTransaction(redeemB.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revealed, err := ExtractSecret(&found, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(revealed, secret) == false {
+		t.Fatalf("ExtractSecret() = %x, want %x", revealed, secret)
+	}
+
+	redeemA := NewRedeemTransaction(contractA.ID, revealed, chainA)
+	chainA.AddBlock("bob", []*Transaction{redeemA})
+
+	for _, test := range []struct {
+		chain   *Blockchain
+		name    string
+		address string
+	}{
+		{chainA, "A", "bob"},
+		{chainB, "B", "alice"},
+	} {
+		//The miner of the redeem block is paid the reward too
+		want := amount + Amount(test.chain.Params.Reward(2))
+		if got := balance(test.chain, test.address); got != want {
+			t.Errorf("balance of %s on chain %s = %s, want %s", test.address, test.name, got, want)
+		}
+	}
+
+	//The contracts are spent: they can't be refunded anymore
+	for _, contract := range []struct {
+		chain *Blockchain
+		ID    []byte
+	}{{chainA, contractA.ID}, {chainB, contractB.ID}} {
+		if _, _, found := (UTXOSet{contract.chain}).FindOutput(contract.ID, 0); found {
+			t.Errorf("contract %x is still unspent", contract.ID)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+/*
+Tips of the stored branches that aren't in the active chain: the blocks disconnected by InvalidateBlock
+or by a switch to a longer branch, and the blocks cleared by ReconsiderBlock. The tip is stored under the prefix followed by its hash.
+A tip that has been connected again is ignored
+*/
+var branchTipPrefix = []byte("branch-")
+
+/*
+Blocks marked invalid by the operator (invalidateblock). The mark of a block is stored under the prefix followed by its hash,
+so it survives restarts and the block is refused by ImportBlock until it is reconsidered.
+Marked blocks stay in the store, which is what allows to reconnect them when they are reconsidered
+*/
+var invalidPrefix = []byte("invalid-")
+
+// Returned when a block that has been marked invalid is connected again
+var ErrInvalidBlock = errors.New("the block has been marked invalid")
+
+/*
+@returns: true if the block has been marked invalid
+*/
+func (chain *Blockchain) IsInvalid(hash []byte) bool {
+	_, err := chain.Database.Get(invalidKey(hash))
+	if err == ErrNotFound {
+		return false
+	}
+	Handle(err)
+
+	return true
+}
+
+/*
+Marks a block and its stored descendants invalid. When the block is in the active chain, the last block is disconnected
+until the parent of the block is the last one: the UTXO set is restored with the undo data and the indexes follow.
+The blockchain then switches to the longest valid branch of the store if it's longer than the parent (see activateBestBranch).
+The transactions of the disconnected blocks are lost unless they are sent again
+
+@returns: the number of disconnected blocks, the number of connected blocks of another branch
+and an error if the block doesn't exist or can't be disconnected
+(the Genesis block, a pruned block or a block below the snapshot the blockchain was loaded from)
+*/
+func (chain *Blockchain) InvalidateBlock(hash []byte) (int, int, error) {
+	chain.writeMu.Lock()
+	defer chain.writeMu.Unlock()
+
+	block, err := getHeader(chain.Database.Get, hash)
+	if err == ErrNotFound {
+		return 0, 0, fmt.Errorf("block %x does not exist", hash)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if block.Height == 0 {
+		return 0, 0, errors.New("the Genesis block can't be invalidated")
+	}
+
+	descendants, err := chain.branchDescendants(block)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	heightIndex := HeightIndex{chain}
+
+	activeHash, err := heightIndex.GetHash(block.Height)
+	var blocks []*Block //The blocks to disconnect, from the last one down to the invalidated one
+
+	if err == nil && bytes.Equal(activeHash, hash) { //Not in the active chain otherwise, there's nothing to disconnect
+		blocks, err = chain.activeBlocksAbove(block.Height - 1)
+		if err != nil {
+			return 0, 0, err
+		}
+	} else {
+		descendants = append(descendants, block)
+	}
+
+	//The marks are written first, so an interrupted rewind is resumed by invalidating the block again
+	err = chain.markInvalid(append(descendants, blocks...))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = chain.disconnectBlocks(blocks)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	disconnected, connected, err := chain.activateBestBranch()
+
+	return len(blocks) + disconnected, connected, err
+}
+
+/*
+Clears the mark of a block, of its marked ancestors and of its marked descendants.
+The blockchain switches to the branch (validating it again) when it's longer than the active chain, otherwise it only stops being refused
+
+@returns: the number of cleared marks, the number of reconnected blocks and the error that stopped the reconnection
+*/
+func (chain *Blockchain) ReconsiderBlock(hash []byte) (int, int, error) {
+	chain.writeMu.Lock()
+	defer chain.writeMu.Unlock()
+
+	marked := make(map[string]bool)
+	err := chain.Database.Iterate(invalidPrefix, func(key, value []byte) error {
+		marked[string(key[len(invalidPrefix):])] = true
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if marked[string(hash)] == false {
+		return 0, 0, fmt.Errorf("block %x is not marked invalid", hash)
+	}
+
+	//Walks up from 'from' through the marked blocks. 'visit' is called for every marked block until it returns false
+	walkMarked := func(from []byte, visit func(block *Block) bool) error {
+		for current := from; marked[string(current)]; {
+			block, err := getHeader(chain.Database.Get, current)
+			if err != nil {
+				return err
+			}
+
+			if visit(block) == false {
+				return nil
+			}
+			current = block.PrevHash
+		}
+
+		return nil
+	}
+
+	cleared := make(map[string]bool)
+
+	err = walkMarked(hash, func(block *Block) bool { //The block and its ancestors
+		cleared[string(block.Hash)] = true
+		return true
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for key := range marked { //The descendants: the marked blocks whose marked ancestors lead to the block
+		var path [][]byte
+
+		err = walkMarked([]byte(key), func(block *Block) bool {
+			if bytes.Equal(block.Hash, hash) {
+				for _, descendant := range path {
+					cleared[string(descendant)] = true
+				}
+				return false
+			}
+
+			path = append(path, block.Hash)
+			return true
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	err = chain.Database.Update(func(batch Batch) error {
+		for key := range cleared {
+			if err := batch.Delete(invalidKey([]byte(key))); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	//The cleared blocks without cleared children are the tips of the branches that can be connected again
+	parents := make(map[string]bool)
+	for key := range cleared {
+		block, err := getHeader(chain.Database.Get, []byte(key))
+		if err != nil {
+			return 0, 0, err
+		}
+		parents[string(block.PrevHash)] = true
+	}
+
+	err = chain.Database.Update(func(batch Batch) error {
+		for key := range cleared {
+			if parents[key] {
+				continue
+			}
+			if err := batch.Set(branchTipKey([]byte(key)), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	_, reconnected, err := chain.activateBestBranch()
+
+	return len(cleared), reconnected, err
+}
+
+/*
+Stored descendants of 'block' that aren't in the active chain, found by going down the PrevHash links from the branch tips
+*/
+func (chain *Blockchain) branchDescendants(block *Block) ([]*Block, error) {
+	found := make(map[string]*Block)
+
+	err := chain.Database.Iterate(branchTipPrefix, func(key, value []byte) error {
+		var path []*Block
+
+		for current := key[len(branchTipPrefix):]; ; {
+			header, err := getHeader(chain.Database.Get, current)
+			if err != nil {
+				return err
+			}
+
+			if header.Height <= block.Height {
+				if bytes.Equal(header.Hash, block.Hash) {
+					for _, descendant := range path {
+						found[string(descendant.Hash)] = descendant
+					}
+				}
+				return nil
+			}
+
+			path = append(path, header)
+			current = header.PrevHash
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	descendants := make([]*Block, 0, len(found))
+	for _, descendant := range found {
+		descendants = append(descendants, descendant)
+	}
+
+	return descendants, nil
+}
+
+/*
+Switches to the longest valid branch of the store while it's longer than the active chain: the active blocks above the fork
+are disconnected and the blocks of the branch are validated and connected. A block that isn't valid is marked invalid
+and the next longest branch is tried. The caller holds writeMu
+
+@returns: the number of disconnected and connected blocks
+*/
+func (chain *Blockchain) activateBestBranch() (int, int, error) {
+	disconnected, connected := 0, 0
+	UTXOSet := UTXOSet{chain}
+
+	for {
+		branch, err := chain.bestBranch()
+		if err != nil || branch == nil {
+			return disconnected, connected, err
+		}
+
+		blocks, err := chain.activeBlocksAbove(branch[0].Height - 1)
+		if err != nil {
+			return disconnected, connected, err
+		}
+
+		err = chain.disconnectBlocks(blocks)
+		if err != nil {
+			return disconnected, connected, err
+		}
+		disconnected += len(blocks)
+
+		for _, block := range branch {
+			err = chain.verifyBlock(block, chain.GetBestHeight()+1, chain.LastHash(), VerifyTransactions, UTXOSet.FindOutput)
+			if err != nil { //The rest of the branch can't be connected either, the next best branch is tried
+				fmt.Printf("Block %d (%x) of a stored branch is invalid: %v\n", block.Height, block.Hash, err)
+
+				if err := chain.markInvalid([]*Block{block}); err != nil {
+					return disconnected, connected, err
+				}
+				break
+			}
+
+			err = chain.connectBlock(block)
+			if err != nil {
+				return disconnected, connected, fmt.Errorf("block %d (%x): %v", block.Height, block.Hash, err)
+			}
+			connected++
+		}
+	}
+}
+
+/*
+The stored branch with the highest valid tip, if it's higher than the last block and its fork can be disconnected
+(it isn't below the pruned blocks or the snapshot the blockchain was loaded from)
+
+@returns: the blocks of the branch above the fork, from the lowest one up, or nil
+*/
+func (chain *Blockchain) bestBranch() ([]*Block, error) {
+	bestHeight := chain.GetBestHeight()
+
+	lowestFork := 0
+	if height, found := chain.PrunedHeight(); found {
+		lowestFork = height
+	}
+	if height, found := chain.SnapshotHeight(); found && height > lowestFork {
+		lowestFork = height
+	}
+
+	var best []*Block
+
+	err := chain.Database.Iterate(branchTipPrefix, func(key, value []byte) error {
+		branch, err := chain.validBranch(key[len(branchTipPrefix):])
+		if err != nil {
+			return err
+		}
+
+		if len(branch) > 0 && branch[len(branch)-1].Height > bestHeight && branch[0].Height-1 >= lowestFork {
+			best = branch
+			bestHeight = branch[len(branch)-1].Height
+		}
+
+		return nil
+	})
+
+	return best, err
+}
+
+/*
+Goes down from 'tip' to the active chain
+
+@returns: the blocks of the branch above the fork that aren't marked invalid and have no invalid ancestor, from the lowest one up
+*/
+func (chain *Blockchain) validBranch(tip []byte) ([]*Block, error) {
+	heightIndex := HeightIndex{chain}
+
+	var branch []*Block
+
+	for current := tip; ; {
+		header, err := getHeader(chain.Database.Get, current) //A tip connected again may have been pruned since
+		if err != nil {
+			return nil, fmt.Errorf("block %x of a stored branch: %v", current, err)
+		}
+
+		if activeHash, err := heightIndex.GetHash(header.Height); err == nil && bytes.Equal(activeHash, header.Hash) {
+			break
+		}
+
+		block, err := chain.Database.GetBlock(current)
+		if err != nil {
+			return nil, fmt.Errorf("block %x of a stored branch: %v", current, err)
+		}
+
+		branch = append([]*Block{block}, branch...)
+		current = block.PrevHash
+	}
+
+	for i, block := range branch {
+		if chain.IsInvalid(block.Hash) {
+			return branch[:i], nil
+		}
+	}
+
+	return branch, nil
+}
+
+/*
+Active blocks above 'height', from the last one down
+
+@returns: an error if one of them can't be disconnected (no undo data)
+*/
+func (chain *Blockchain) activeBlocksAbove(height int) ([]*Block, error) {
+	var blocks []*Block
+
+	iter := chain.Iterator()
+	for current := iter.Next(); current != nil && current.Height > height; current = iter.Next() {
+		if _, err := getUndo(chain.Database.Get, current.Hash); err != nil {
+			return nil, fmt.Errorf("block %d can't be disconnected: %v", current.Height, err)
+		}
+
+		blocks = append(blocks, current)
+	}
+	if iter.Err() != nil {
+		return nil, fmt.Errorf("can't rewind the blockchain: %w", iter.Err())
+	}
+
+	return blocks, nil
+}
+
+/*
+Disconnects 'blocks' (from the last one down) and records the last one as the tip of a stored branch. The caller holds writeMu
+*/
+func (chain *Blockchain) disconnectBlocks(blocks []*Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	err := chain.Database.Update(func(batch Batch) error {
+		return batch.Set(branchTipKey(blocks[0].Hash), []byte{})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		err = chain.disconnectBlock(block)
+		if err != nil {
+			return fmt.Errorf("block %d (%x): %v", block.Height, block.Hash, err)
+		}
+	}
+
+	return nil
+}
+
+/*
+Disconnects the last block, writing the UTXO set, the indexes and the last hash in a single atomic batch.
+The caller holds writeMu
+*/
+func (chain *Blockchain) disconnectBlock(block *Block) error {
+	addressIndex := AddressIndex{chain}
+	UTXOSet := UTXOSet{chain}
+	heightIndex := HeightIndex{chain}
+	txIndex := TxIndex{chain}
+
+	addressIndexEnabled := addressIndex.Enabled()
+	txIndexEnabled := txIndex.Enabled()
+
+	err := chain.Database.Update(func(batch Batch) error {
+		tip, err := batch.Get(tipKey)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(tip, block.Hash) == false {
+			return errors.New("the block is not the last block")
+		}
+
+		if addressIndexEnabled {
+			addressIndex.DisconnectBlock(batch, block)
+		}
+
+		err = UTXOSet.DisconnectBlock(batch, block)
+		if err != nil {
+			return err
+		}
+
+		heightIndex.DisconnectBlock(batch, block)
+
+		if txIndexEnabled {
+			txIndex.DisconnectBlock(batch, block)
+		}
+
+		indexesTip, err := batch.Get(indexesTipKey)
+		if err == nil && bytes.Equal(indexesTip, block.Hash) { //Indexes that were already out of sync stay marked as such
+			err = batch.Set(indexesTipKey, block.PrevHash)
+			Handle(err)
+		}
+
+		return batch.SetTip(block.PrevHash)
+	})
+	if err != nil {
+		return err
+	}
+
+	chain.setLastHash(block.PrevHash)
+
+	return nil
+}
+
+func (chain *Blockchain) markInvalid(blocks []*Block) error {
+	return chain.Database.Update(func(batch Batch) error {
+		for _, block := range blocks {
+			if err := batch.Set(invalidKey(block.Hash), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func invalidKey(hash []byte) []byte {
+	return append(append([]byte{}, invalidPrefix...), hash...)
+}
+
+func branchTipKey(hash []byte) []byte {
+	return append(append([]byte{}, branchTipPrefix...), hash...)
+}
@@ -0,0 +1,100 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestInvalidateAndReconsiderBlock(t *testing.T) {
+	chain := newTestChain(t)
+	genesis := chain.LastHash()
+
+	b1 := chain.AddBlock("bob", nil)
+	b2 := chain.AddBlock("bob", nil)
+
+	disconnected, connected, err := chain.InvalidateBlock(b1.Hash)
+	if err != nil || disconnected != 2 || connected != 0 {
+		t.Fatalf("InvalidateBlock() = %d, %d, %v, want 2 disconnected blocks", disconnected, connected, err)
+	}
+	if bytes.Equal(chain.LastHash(), genesis) == false {
+		t.Fatalf("the last block is %x, want the Genesis block", chain.LastHash())
+	}
+	if chain.IsInvalid(b2.Hash) == false {
+		t.Fatal("the descendant of the invalidated block isn't marked")
+	}
+	if err := chain.ImportBlock(b1); errors.Is(err, ErrInvalidBlock) == false {
+		t.Fatalf("ImportBlock() of an invalid block = %v, want %v", err, ErrInvalidBlock)
+	}
+
+	cleared, reconnected, err := chain.ReconsiderBlock(b1.Hash)
+	if err != nil || cleared != 2 || reconnected != 2 {
+		t.Fatalf("ReconsiderBlock() = %d, %d, %v, want 2 cleared and reconnected blocks", cleared, reconnected, err)
+	}
+	if bytes.Equal(chain.LastHash(), b2.Hash) == false {
+		t.Fatalf("the last block is %x, want the reconsidered block %x", chain.LastHash(), b2.Hash)
+	}
+	if problems := chain.CheckConsistency(); len(problems) > 0 {
+		t.Fatalf("inconsistent after the reconnection: %q", problems)
+	}
+}
+
+func TestInvalidateBlockSwitchesToTheBestBranch(t *testing.T) {
+	chain := newTestChain(t)
+
+	//Branch b: two blocks, invalidated then reconsidered while branch c is longer
+	b1 := chain.AddBlock("bob", nil)
+	b2 := chain.AddBlock("bob", nil)
+	if _, _, err := chain.InvalidateBlock(b1.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	c1 := chain.AddBlock("carol", nil)
+	c2 := chain.AddBlock("carol", nil)
+	c3 := chain.AddBlock("carol", nil)
+
+	cleared, reconnected, err := chain.ReconsiderBlock(b1.Hash)
+	if err != nil || cleared != 2 || reconnected != 0 {
+		t.Fatalf("ReconsiderBlock() = %d, %d, %v, want 2 cleared blocks and none reconnected", cleared, reconnected, err)
+	}
+	if bytes.Equal(chain.LastHash(), c3.Hash) == false {
+		t.Fatal("a shorter branch replaced the active chain")
+	}
+
+	//Invalidating a block of a stored branch marks its stored descendants
+	if _, _, err := chain.InvalidateBlock(b1.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if chain.IsInvalid(b2.Hash) == false {
+		t.Fatal("the descendant of the invalidated side block isn't marked")
+	}
+	if _, _, err := chain.ReconsiderBlock(b1.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	//Rewound to c1, branch b is longer: c1 is disconnected too and branch b is connected
+	disconnected, connected, err := chain.InvalidateBlock(c2.Hash)
+	if err != nil || disconnected != 3 || connected != 2 {
+		t.Fatalf("InvalidateBlock() = %d, %d, %v, want 3 disconnected and 2 connected blocks", disconnected, connected, err)
+	}
+	if bytes.Equal(chain.LastHash(), b2.Hash) == false {
+		t.Fatalf("the last block is %x, want the tip of the longer branch %x", chain.LastHash(), b2.Hash)
+	}
+
+	heightIndex := HeightIndex{chain}
+	if hash, _ := heightIndex.GetHash(1); bytes.Equal(hash, b1.Hash) == false {
+		t.Error("the height index doesn't follow the new branch")
+	}
+	if problems := chain.CheckConsistency(); len(problems) > 0 {
+		t.Fatalf("inconsistent after the switch: %q", problems)
+	}
+
+	//c1 is valid again as a side block: invalidating b1 goes back to it
+	disconnected, connected, err = chain.InvalidateBlock(b1.Hash)
+	if err != nil || disconnected != 2 || connected != 1 {
+		t.Fatalf("InvalidateBlock() = %d, %d, %v, want 2 disconnected and 1 connected blocks", disconnected, connected, err)
+	}
+	if bytes.Equal(chain.LastHash(), c1.Hash) == false {
+		t.Fatalf("the last block is %x, want the valid side block %x", chain.LastHash(), c1.Hash)
+	}
+}
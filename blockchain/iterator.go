@@ -0,0 +1,148 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+)
+
+/*
+Struct used to iterate through a range of heights of the active chain, from the oldest block to the most recent one.
+The blocks are found with the height index, so the iteration doesn't have to start from the last block.
+  - next: height of the next block to return
+  - end: height of the last block to return
+*/
+type HeightIterator struct {
+	Blockchain *Blockchain
+
+	next     int
+	end      int
+	prevHash []byte //hash of the block returned last, to check that the blocks are still linked
+	err      error
+}
+
+/*
+Iterator that goes forward from the Genesis block to the last block at the time it is created.
+Blocks added meanwhile aren't returned
+*/
+func (chain *Blockchain) ForwardIterator() *HeightIterator {
+	return &HeightIterator{Blockchain: chain, next: 0, end: chain.GetBestHeight()}
+}
+
+/*
+Iterator that goes forward from the block at height 'from' to the block at height 'to' (both included)
+
+@returns: the iterator or an error if the range isn't part of the active chain
+*/
+func (chain *Blockchain) RangeIterator(from, to int) (*HeightIterator, error) {
+	bestHeight := chain.GetBestHeight()
+
+	if from < 0 || from > to {
+		return nil, fmt.Errorf("invalid height range %d-%d", from, to)
+	}
+	if to > bestHeight {
+		return nil, fmt.Errorf("height %d is above the last block (height %d)", to, bestHeight)
+	}
+
+	return &HeightIterator{Blockchain: chain, next: from, end: to}, nil
+}
+
+/*
+@returns a pointer to the next block of the range, nil after the last block of the range or if a block can't be read (see Err)
+*/
+func (iter *HeightIterator) Next() *Block {
+	if iter.next > iter.end || iter.err != nil {
+		return nil
+	}
+
+	block, err := iter.Blockchain.GetBlockByHeight(iter.next)
+	if err != nil {
+		iter.err = fmt.Errorf("block at height %d: %v", iter.next, err)
+		return nil
+	}
+
+	//The height index follows the active chain: a block that doesn't extend the previous one means the chain changed under the iterator
+	if iter.prevHash != nil && bytes.Equal(block.PrevHash, iter.prevHash) == false {
+		iter.err = fmt.Errorf("the active chain changed at height %d during the iteration", iter.next)
+		return nil
+	}
+
+	iter.prevHash = block.Hash
+	iter.next++
+
+	return block
+}
+
+/*
+@returns: the error that stopped the iteration, nil if the iteration reached the end of the range
+*/
+func (iter *HeightIterator) Err() error {
+	return iter.err
+}
+
+/* ------------------ SEQUENCES ------------------- */
+/*
+The sequences are iter.Seq2[*Block, error], so they can be used with range-over-func:
+
+	for block, err := range chain.Blocks() {
+		if err != nil {
+			...
+		}
+	}
+
+A sequence yields the blocks in order and stops after yielding an error (with a nil block).
+*/
+
+/*
+@returns: the blocks from the last block to the Genesis block
+*/
+func (chain *Blockchain) Blocks() iter.Seq2[*Block, error] {
+	return func(yield func(*Block, error) bool) {
+		iter := chain.Iterator()
+
+		for block := iter.Next(); block != nil; block = iter.Next() {
+			if !yield(block, nil) {
+				return
+			}
+		}
+
+		if iter.Err() != nil {
+			yield(nil, iter.Err())
+		}
+	}
+}
+
+/*
+@returns: the blocks from the Genesis block to the last block
+*/
+func (chain *Blockchain) BlocksForward() iter.Seq2[*Block, error] {
+	return heightSeq(chain.ForwardIterator(), nil)
+}
+
+/*
+@returns: the blocks from height 'from' to height 'to' (both included). An invalid range is yielded as an error
+*/
+func (chain *Blockchain) BlocksInRange(from, to int) iter.Seq2[*Block, error] {
+	iter, err := chain.RangeIterator(from, to)
+
+	return heightSeq(iter, err)
+}
+
+func heightSeq(iter *HeightIterator, err error) iter.Seq2[*Block, error] {
+	return func(yield func(*Block, error) bool) {
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		for block := iter.Next(); block != nil; block = iter.Next() {
+			if !yield(block, nil) {
+				return
+			}
+		}
+
+		if iter.Err() != nil {
+			yield(nil, iter.Err())
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"iter"
+	"reflect"
+	"testing"
+)
+
+func TestBlockSequencesOrder(t *testing.T) {
+	chain := newTestChain(t)
+	for i := 0; i < 3; i++ {
+		chain.AddBlock("miner", nil)
+	}
+
+	heights := func(seq iter.Seq2[*Block, error]) []int {
+		var heights []int
+		for block, err := range seq {
+			if err != nil {
+				t.Fatal(err)
+			}
+			heights = append(heights, block.Height)
+		}
+
+		return heights
+	}
+
+	tests := map[string]struct {
+		got  []int
+		want []int
+	}{
+		"Blocks":        {heights(chain.Blocks()), []int{3, 2, 1, 0}},
+		"BlocksForward": {heights(chain.BlocksForward()), []int{0, 1, 2, 3}},
+		"BlocksInRange": {heights(chain.BlocksInRange(1, 2)), []int{1, 2}},
+	}
+
+	for name, test := range tests {
+		if reflect.DeepEqual(test.got, test.want) == false {
+			t.Errorf("%s() yields heights %v, want %v", name, test.got, test.want)
+		}
+	}
+}
+
+func TestBlockSequencesBreak(t *testing.T) {
+	chain := newTestChain(t)
+	for i := 0; i < 3; i++ {
+		chain.AddBlock("miner", nil)
+	}
+
+	for name, seq := range map[string]iter.Seq2[*Block, error]{
+		"Blocks":        chain.Blocks(),
+		"BlocksForward": chain.BlocksForward(),
+	} {
+		count := 0
+		for range seq { //Yielding after the break panics
+			count++
+			if count == 2 {
+				break
+			}
+		}
+
+		if count != 2 {
+			t.Errorf("%s() yielded %d blocks before the break, want 2", name, count)
+		}
+	}
+}
+
+func TestBlockSequencesErrors(t *testing.T) {
+	chain := newTestChain(t)
+	for i := 0; i < 3; i++ {
+		chain.AddBlock("miner", nil)
+	}
+
+	missing, err := chain.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = chain.Database.Update(func(batch Batch) error {
+		return batch.Delete(missing.Hash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, test := range map[string]struct {
+		seq    iter.Seq2[*Block, error]
+		blocks int //Blocks yielded before the error
+		errors int
+	}{
+		"Blocks":                {chain.Blocks(), 2, 1},
+		"BlocksForward":         {chain.BlocksForward(), 1, 1},
+		"BlocksInRange":         {chain.BlocksInRange(2, 3), 2, 0}, //The missing block is below the range
+		"BlocksInRange invalid": {chain.BlocksInRange(2, 9), 0, 1},
+	} {
+		blocks, errors := 0, 0
+		for block, err := range test.seq {
+			if err != nil {
+				errors++
+				if block != nil {
+					t.Errorf("%s() yielded a block with the error", name)
+				}
+				continue
+			}
+			blocks++
+		}
+
+		if blocks != test.blocks || errors != test.errors {
+			t.Errorf("%s() yielded %d blocks and %d errors, want %d and %d", name, blocks, errors, test.blocks, test.errors)
+		}
+	}
+}
@@ -26,33 +26,34 @@ REQUIREMENTS:
 
 */
 
-// Here we are hard coding the difficulty but we would also want an algorithm that increases the difficulty after a large period of time
+// The difficulty is fixed by the parameters of the chain (see network.ChainParams) but we would also want an algorithm that increases the difficulty after a large period of time
 // This is to account for the increasing number of miners on the network and the increasing computation power of the network by all miners.
 // We want to make the time to mine a block stay the same and also want to have the block rate stay the same.
-const Difficulty = 18
 
 //Proof of the work done for signing a new block:
 /*
 - Block: pointer to a Block
 - Target: pointer to a Big Integer. Integers are accurate but have a limited range. What if you need a really big, accurate number? big.Int (Big integer)
+- Difficulty: number of leading zero bits of the Target
 */
 type ProofOfWork struct {
-	Block  *Block
-	Target *big.Int //Target will be derived from the Difficulty
+	Block      *Block
+	Target     *big.Int //Target will be derived from the Difficulty
+	Difficulty int
 }
 
 /*
-@parameters: pointer to a block
+@parameters: pointer to a block, difficulty of the chain (see network.ChainParams)
 @returns: pointer to a ProofOfWork
 
 We are taking a Block and pairing it with target
 */
-func NewProof(b *Block) *ProofOfWork {
+func NewProof(b *Block, difficulty int) *ProofOfWork {
 	target := big.NewInt(1) //0000....1
 
-	target.Lsh(target, uint(256-Difficulty)) //we are left shifting target by 256 (bytes of a hash) minus the difficulty
+	target.Lsh(target, uint(256-difficulty)) //we are left shifting target by 256 (bytes of a hash) minus the difficulty
 
-	pow := &ProofOfWork{b, target} //creating the ProofOfWork pointer
+	pow := &ProofOfWork{b, target, difficulty} //creating the ProofOfWork pointer
 
 	return pow
 }
@@ -71,7 +72,9 @@ func (pow *ProofOfWork) InitData(nonce int) []byte {
 			pow.Block.PrevHash,
 			pow.Block.HashTransactions(),
 			ToHex(int64(nonce)),
-			ToHex(int64(Difficulty)),
+			ToHex(int64(pow.Difficulty)),
+			ToHex(int64(pow.Block.Height)), //The height is part of the hash so it can't be changed after the block is mined
+			ToHex(pow.Block.Timestamp),
 		},
 		[]byte{},
 	)
@@ -0,0 +1,209 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+)
+
+/*
+Pruning replaces the blocks deeper than the prune depth with their header and deletes their undo data,
+as only the UTXO set is needed to validate new transactions.
+The header keeps everything but the transactions (and the hash of the transactions, which the hash of the block commits to),
+so the height index and the links between the blocks stay intact.
+The commands that need the transactions of a pruned block fail with ErrPruned.
+*/
+
+// Number of blocks below the last one whose transactions and undo data the pruning must keep, so the last blocks can still be disconnected
+const MinPruneDepth = 10
+
+// Number of blocks pruned while connecting blocks after which the space is given back to the filesystem (see Store.CollectGarbage)
+const pruneGCInterval = 100
+
+// Height of the last pruned block: every block up to it has been pruned
+var prunedHeightKey = []byte("pruned-h")
+
+// Maximum number of blocks pruned in a single batch (a Badger transaction can only hold a limited number of writes)
+const pruneBatchSize = 1000
+
+/*
+What is left of a pruned block. The field names are the ones of Block, so a pruned block is read as a Block without transactions
+*/
+type blockHeader struct {
+	Hash      []byte
+	PrevHash  []byte
+	Nonce     int
+	Height    int
+	Timestamp int64
+	TxHash    []byte //Block.HashTransactions of the deleted transactions
+}
+
+func (h *blockHeader) Serialize() []byte {
+	var res bytes.Buffer
+
+	err := gob.NewEncoder(&res).Encode(h)
+	Handle(err)
+
+	return res.Bytes()
+}
+
+/*
+@returns: the height of the last pruned block and false if no block has been pruned
+*/
+func (chain *Blockchain) PrunedHeight() (int, bool) {
+	data, err := chain.Database.Get(prunedHeightKey)
+	if err == ErrNotFound {
+		return 0, false
+	}
+	Handle(err)
+
+	return int(binary.BigEndian.Uint64(data)), true
+}
+
+/*
+Prunes the blocks that have more than 'depth' blocks on top of them and gives the space back to the filesystem
+
+@returns: the number of pruned blocks
+*/
+func (chain *Blockchain) Prune(depth int) (int, error) {
+	chain.writeMu.Lock()
+	defer chain.writeMu.Unlock()
+
+	pruned, err := chain.prune(depth)
+	if err != nil {
+		return pruned, err
+	}
+
+	if pruned > 0 || chain.prunedSinceGC > 0 {
+		chain.prunedSinceGC = 0
+		err = chain.Database.CollectGarbage()
+	}
+
+	return pruned, err
+}
+
+/*
+Sets the number of blocks below the last one whose transactions and undo data are kept when new blocks are connected
+(0 disables the pruning) and prunes the blocks that are already deeper (see Prune)
+
+@returns: the number of pruned blocks
+*/
+func (chain *Blockchain) SetPruneDepth(depth int) (int, error) {
+	if depth == 0 {
+		chain.writeMu.Lock()
+		chain.pruneDepth = 0
+		chain.writeMu.Unlock()
+
+		return 0, nil
+	}
+
+	pruned, err := chain.Prune(depth)
+	if err != nil {
+		return pruned, err
+	}
+
+	chain.writeMu.Lock()
+	chain.pruneDepth = depth
+	chain.writeMu.Unlock()
+
+	return pruned, nil
+}
+
+/*
+Prunes the blocks below the prune depth after a block is connected. The garbage collection of the store rewrites whole files,
+so it only runs once every pruneGCInterval pruned blocks. The caller holds writeMu
+*/
+func (chain *Blockchain) pruneConnected() error {
+	if chain.pruneDepth == 0 {
+		return nil
+	}
+
+	pruned, err := chain.prune(chain.pruneDepth)
+	chain.prunedSinceGC += pruned
+	if err != nil {
+		return err
+	}
+
+	if chain.prunedSinceGC < pruneGCInterval {
+		return nil
+	}
+
+	chain.prunedSinceGC = 0
+
+	return chain.Database.CollectGarbage()
+}
+
+func (chain *Blockchain) prune(depth int) (int, error) {
+	if depth < MinPruneDepth {
+		return 0, fmt.Errorf("the prune depth must be at least %d blocks", MinPruneDepth)
+	}
+
+	from := 0
+	if prunedHeight, found := chain.PrunedHeight(); found {
+		from = prunedHeight + 1
+	}
+
+	to := chain.GetBestHeight() - depth
+	if to < from {
+		return 0, nil
+	}
+
+	heightIndex := HeightIndex{chain}
+	pruned := 0
+
+	for start := from; start <= to; start += pruneBatchSize {
+		end := start + pruneBatchSize - 1
+		if end > to {
+			end = to
+		}
+
+		err := chain.Database.Update(func(batch Batch) error {
+			for height := start; height <= end; height++ {
+				hash, err := heightIndex.GetHash(height)
+				if err != nil { //Below the snapshot the blockchain was loaded from
+					continue
+				}
+
+				block, err := getBlock(batch.Get, hash)
+				if err == ErrNotFound || err == ErrPruned {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				header := blockHeader{block.Hash, block.PrevHash, block.Nonce, block.Height, block.Timestamp, block.HashTransactions()}
+
+				err = batch.Set(block.Hash, header.Serialize())
+				if err != nil {
+					return err
+				}
+
+				err = batch.Delete(undoKey(block.Hash)) //A pruned block can't be disconnected anyway
+				if err != nil {
+					return err
+				}
+				pruned++
+			}
+
+			return batch.Set(prunedHeightKey, binary.BigEndian.AppendUint64(nil, uint64(end)))
+		})
+		if err != nil {
+			return pruned, err
+		}
+	}
+
+	return pruned, nil
+}
+
+/*
+@returns: an error explaining that the blocks needed by 'action' have been pruned, nil if the blockchain isn't pruned
+*/
+func (chain *Blockchain) checkNotPruned(action string) error {
+	if prunedHeight, found := chain.PrunedHeight(); found {
+		return fmt.Errorf("%s needs every block, but the blocks up to height %d have been pruned", action, prunedHeight)
+	}
+
+	return nil
+}
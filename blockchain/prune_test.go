@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+// Store counting the garbage collections
+type collectingStore struct {
+	*MemoryStore
+	collections int
+}
+
+func (s *collectingStore) CollectGarbage() error {
+	s.collections++
+	return nil
+}
+
+func TestPrune(t *testing.T) {
+	chain := newTestChain(t)
+	store := &collectingStore{MemoryStore: chain.Database.(*MemoryStore)}
+	chain.Database = store
+
+	for i := 0; i < MinPruneDepth+2; i++ {
+		chain.AddBlock("miner", nil)
+	}
+
+	if _, err := chain.SetPruneDepth(MinPruneDepth - 1); err == nil {
+		t.Fatal("a prune depth below the minimum was accepted")
+	}
+
+	//Heights 0 to 2 have more than MinPruneDepth blocks on top of them
+	pruned, err := chain.SetPruneDepth(MinPruneDepth)
+	if err != nil || pruned != 3 {
+		t.Fatalf("SetPruneDepth() = %d, %v, want 3 pruned blocks", pruned, err)
+	}
+	if height, found := chain.PrunedHeight(); !found || height != 2 {
+		t.Fatalf("PrunedHeight() = %d, %v, want 2", height, found)
+	}
+	if store.collections != 1 {
+		t.Fatalf("%d garbage collections after Prune, want 1", store.collections)
+	}
+
+	block, err := chain.GetBlockByHeight(2)
+	if errors.Is(err, ErrPruned) == false {
+		t.Fatalf("GetBlockByHeight() of a pruned block = %v, want %v", err, ErrPruned)
+	}
+
+	header, err := getHeader(chain.Database.Get, chain.LastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for header.Height > 2 {
+		if header, err = getHeader(chain.Database.Get, header.PrevHash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(header.Transactions) != 0 {
+		t.Fatal("the pruned block kept its transactions")
+	}
+	if _, err := chain.Database.Get(undoKey(header.Hash)); err != ErrNotFound {
+		t.Errorf("the undo data of the pruned block = %v, want %v", err, ErrNotFound)
+	}
+
+	if block, err = chain.GetBlockByHeight(3); err != nil || len(block.Transactions) == 0 {
+		t.Fatalf("GetBlockByHeight() of a kept block = %v", err)
+	}
+
+	//The commands that need every block fail
+	iter := chain.Iterator()
+	for block := iter.Next(); block != nil; block = iter.Next() {
+	}
+	if errors.Is(iter.Err(), ErrPruned) == false {
+		t.Errorf("the iteration stopped with %v, want %v", iter.Err(), ErrPruned)
+	}
+
+	if err := chain.checkNotPruned("the test"); err == nil {
+		t.Error("checkNotPruned() didn't report the pruned blocks")
+	}
+
+	//Every connected block prunes one block, the garbage is only collected every pruneGCInterval blocks
+	chain.AddBlock("miner", nil)
+	if height, _ := chain.PrunedHeight(); height != 3 {
+		t.Fatalf("PrunedHeight() = %d after a new block, want 3", height)
+	}
+	if store.collections != 1 {
+		t.Fatalf("%d garbage collections after connecting a block, want 1", store.collections)
+	}
+
+	for i := 0; i < pruneGCInterval; i++ {
+		chain.AddBlock("miner", nil)
+	}
+	if store.collections != 2 {
+		t.Fatalf("%d garbage collections after %d pruned blocks, want 2", store.collections, pruneGCInterval+1)
+	}
+
+	//Disabled: new blocks don't prune anymore
+	chain.SetPruneDepth(0)
+	prunedHeight, _ := chain.PrunedHeight()
+	chain.AddBlock("miner", nil)
+	if height, _ := chain.PrunedHeight(); height != prunedHeight {
+		t.Errorf("PrunedHeight() = %d with the pruning disabled, want %d", height, prunedHeight)
+	}
+}
@@ -0,0 +1,656 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/pierobassa/golang-blockchain/network"
+)
+
+/*
+The layout of the store (keys, prefixes and encodings of the values) has a version, stored under the key below.
+NewBlockchain writes the current version and LoadBlockchain refuses a store with another one, so a layout change can't be
+read as garbage. A store written before the version existed has version 0: Migrate upgrades it one migration at a time
+*/
+var schemaVersionKey = []byte("schema-version")
+
+// Version of the layout written by this version of the program (the version of the last migration)
+const SchemaVersion = 3
+
+// Returned when the store has another layout than the one of this version of the program
+var ErrSchemaVersion = errors.New("unsupported schema version")
+
+/*
+A step of the upgrade of the layout of a store
+  - Version: version of the layout once the migration has run
+  - Description: what the migration does
+  - Destructive: the migration deletes or rewrites data, so Migrate backs the store up before running it
+*/
+type Migration struct {
+	Version     int
+	Description string
+	Destructive bool
+
+	run func(chain *Blockchain) error
+}
+
+// Every migration, in version order. A new layout adds its migration here and bumps SchemaVersion
+var migrations = []Migration{
+	{1, "Rebuild the UTXO set, whose entries didn't have the coinbase flag before the chain parameters were introduced", true, migrateUTXOSet},
+	{2, "Write the undo data of the blocks, so they can be disconnected by invalidateblock", false, migrateUndoData},
+	{3, "Compute the transaction IDs and the redeem script hashes from their fixed encodings instead of gob, which changes the hash of every block", true, migrateEncodings},
+}
+
+// Upgrade of the first layout (see firstLayout), which replaces every other migration
+var firstLayoutMigration = Migration{
+	SchemaVersion,
+	"Convert the blocks of the first versions of the program (heights, coinbase transactions, values in the smallest unit, transaction IDs) and build the UTXO set",
+	true,
+	migrateFirstLayout,
+}
+
+/*
+@returns: the version of the layout of the store (0 if it was written before the version existed)
+*/
+func GetSchemaVersion(store Store) (int, error) {
+	data, err := store.Get(schemaVersionKey)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int(binary.BigEndian.Uint64(data)), nil
+}
+
+func setSchemaVersion(batch Batch, version int) error {
+	return batch.Set(schemaVersionKey, binary.BigEndian.AppendUint64(nil, uint64(version)))
+}
+
+/*
+@returns: ErrSchemaVersion (wrapped) if the store has to be migrated or was written by a newer version of the program
+*/
+func checkSchemaVersion(store Store) error {
+	version, err := GetSchemaVersion(store)
+	if err != nil {
+		return err
+	}
+
+	if version < SchemaVersion {
+		return fmt.Errorf("%w: the database has version %d and must be upgraded to version %d, run migratedb", ErrSchemaVersion, version, SchemaVersion)
+	}
+
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: the database has version %d and was written by a newer version of the program (this one reads version %d)", ErrSchemaVersion, version, SchemaVersion)
+	}
+
+	return nil
+}
+
+/*
+Upgrades the layout of the store to SchemaVersion, one migration at a time. The version is written after every migration,
+so an interrupted upgrade resumes with the migration that didn't complete.
+Before the first destructive migration the whole store is written to 'backupPath', which must not exist
+(the backup of a failed upgrade is kept, so a new attempt needs another path).
+The layout of the first versions of the program is converted to SchemaVersion in a single migration (see firstLayout).
+With 'dryRun' nothing is written. 'progress' (optional) is called before every migration
+
+@returns: the migrations that have been run (the pending ones with 'dryRun') and the error that stopped the upgrade
+*/
+func Migrate(store Store, params *network.ChainParams, backupPath string, dryRun bool, progress func(migration Migration)) ([]Migration, error) {
+	version, err := GetSchemaVersion(store)
+	if err != nil {
+		return nil, err
+	}
+
+	if version > SchemaVersion {
+		return nil, checkSchemaVersion(store)
+	}
+
+	isFirstLayout := false
+	if version == 0 {
+		isFirstLayout, err = firstLayout(store)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+
+	if isFirstLayout {
+		pending = []Migration{firstLayoutMigration}
+	}
+
+	if dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+
+	lastHash, err := store.GetTip()
+	if err == ErrNotFound {
+		return nil, errors.New("no existing blockchain found in the store")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//The consistency checks of LoadBlockchain would read the old layout, so the blockchain is opened as it is
+	chain := &Blockchain{lastHash: lastHash, Database: store, Params: params}
+
+	var done []Migration
+	backedUp := false
+
+	for _, migration := range pending {
+		if migration.Destructive && !backedUp {
+			err = backupStore(store, backupPath)
+			if err != nil {
+				return done, fmt.Errorf("backup before the migration to version %d: %v", migration.Version, err)
+			}
+			backedUp = true
+		}
+
+		if progress != nil {
+			progress(migration)
+		}
+
+		err = migration.run(chain)
+		if err != nil {
+			return done, fmt.Errorf("migration to version %d: %v", migration.Version, err)
+		}
+
+		err = store.Update(func(batch Batch) error {
+			return setSchemaVersion(batch, migration.Version)
+		})
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Stops the search of the UTXO set of firstLayout at the first entry
+var errUTXOFound = errors.New("UTXO set found")
+
+/*
+The first versions of the program (the ./tmp/blocks directory of the original code) only stored the blocks and the last hash:
+no UTXO set, blocks without height and outputs without the fields added since. Version 0 starts with the UTXO set
+
+@returns: true if the store has a blockchain without a UTXO set
+*/
+func firstLayout(store Store) (bool, error) {
+	if _, err := store.GetTip(); err != nil {
+		return false, nil //No blockchain to read
+	}
+
+	err := store.Iterate(utxoPrefix, func(key, value []byte) error {
+		return errUTXOFound
+	})
+	if err == errUTXOFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func backupStore(store Store, path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644) //An older backup is never overwritten
+	if err != nil {
+		return err
+	}
+
+	err = store.Backup(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+/* -------------- MIGRATIONS -------------- */
+
+/*
+Version 1. The chains that are pruned or were loaded from a snapshot can't be replayed, but they were created by versions
+that already wrote the coinbase flag
+*/
+func migrateUTXOSet(chain *Blockchain) error {
+	if _, found := chain.PrunedHeight(); found {
+		return nil
+	}
+	if _, found := chain.SnapshotHeight(); found {
+		return nil
+	}
+
+	UTXOSet := UTXOSet{chain}
+	UTXOSet.reindex()
+
+	return nil
+}
+
+/*
+Version 2. The undo data of every block is the one written while the UTXO set is replayed from the Genesis block.
+The blocks of a pruned chain or below the snapshot a chain was loaded from can't be replayed and stay without undo data
+*/
+func migrateUndoData(chain *Blockchain) error {
+	if _, found := chain.PrunedHeight(); found {
+		return nil
+	}
+	if _, found := chain.SnapshotHeight(); found {
+		return nil
+	}
+
+	var hashes [][]byte
+
+	iter := chain.Iterator()
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		hashes = append(hashes, block.Hash)
+	}
+	if iter.Err() != nil {
+		return iter.Err()
+	}
+
+	replay := NewMemoryStore()
+
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := chain.Database.GetBlock(hashes[i])
+		if err != nil {
+			return fmt.Errorf("block %x: %v", hashes[i], err)
+		}
+
+		err = replayBlock(replay, block)
+		if err != nil {
+			return fmt.Errorf("block %d (%x): %v", block.Height, block.Hash, err)
+		}
+	}
+
+	//The undo data is copied in chunks, a Badger transaction can only hold a limited number of writes
+	writer := chunkedWriter{store: chain.Database}
+
+	err := replay.Iterate(undoPrefix, writer.Set)
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+/*
+Version 3. The IDs of the transactions and the hashes of the redeem scripts were computed from gob encodings, which depend on
+what the process encoded before: they are computed again from the fixed encodings (see Transaction.Serialize and RedeemScript.Serialize).
+The inputs reference the new IDs and reveal their redeem script in the new encoding, so every block is mined again
+(with the same height and timestamp) and the active chain is replaced (see replaceChain).
+A script hash output takes the hash of the new encoding when the script has been revealed by an input of the blockchain
+(the one spending it or one spending another output to the same address). The outputs to an address whose script has never been revealed
+keep the old hash, which no script in the new encoding matches.
+The blocks of a pruned chain or below the snapshot a chain was loaded from are gone, so such a chain can't be migrated
+*/
+func migrateEncodings(chain *Blockchain) error {
+	if _, found := chain.PrunedHeight(); found {
+		return errors.New("the transactions of the pruned blocks can't be encoded again, create a new blockchain")
+	}
+	if _, found := chain.SnapshotHeight(); found {
+		return errors.New("the blocks below the snapshot the blockchain was loaded from can't be encoded again, create a new blockchain")
+	}
+
+	var old []*Block
+	var oldHashes [][]byte
+
+	iter := chain.Iterator()
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		old = append(old, block)
+		oldHashes = append(oldHashes, block.Hash)
+	}
+	if iter.Err() != nil {
+		return iter.Err()
+	}
+
+	slices.Reverse(old) //From the Genesis block
+	slices.Reverse(oldHashes)
+
+	transactions := make(map[string]*Transaction) //old ID -> transaction
+	scriptHashes := make(map[string][]byte)       //old script hash -> hash of the new encoding
+
+	for _, block := range old {
+		for _, tx := range block.Transactions {
+			transactions[string(tx.ID)] = tx
+
+			for _, in := range tx.Inputs {
+				if len(in.RedeemScript) == 0 {
+					continue
+				}
+
+				script, err := deserializeGobScript(in.RedeemScript)
+				if err != nil {
+					return fmt.Errorf("transaction %x: redeem script: %v", tx.ID, err)
+				}
+
+				spent, found := transactions[string(in.ID)]
+				if !found || in.Out < 0 || in.Out >= len(spent.Outputs) {
+					return fmt.Errorf("transaction %x: output %s not found", tx.ID, formatOutpoint(in.ID, in.Out))
+				}
+
+				scriptHashes[string(spent.Outputs[in.Out].ScriptHash)] = script.Hash()
+			}
+		}
+	}
+
+	ids := make(map[string][]byte) //old ID -> new ID
+	blocks := make([]*Block, 0, len(old))
+	prevHash := []byte{}
+
+	for _, block := range old {
+		var txs []*Transaction
+
+		for _, tx := range block.Transactions {
+			encoded := &Transaction{}
+
+			for _, in := range tx.Inputs {
+				if tx.isCoinbase() == false {
+					id, found := ids[string(in.ID)]
+					if !found {
+						return fmt.Errorf("transaction %x: output %s not found", tx.ID, formatOutpoint(in.ID, in.Out))
+					}
+					in.ID = id
+				}
+
+				if len(in.RedeemScript) > 0 {
+					script, err := deserializeGobScript(in.RedeemScript)
+					if err != nil {
+						return fmt.Errorf("transaction %x: redeem script: %v", tx.ID, err)
+					}
+					in.RedeemScript = script.Serialize()
+				}
+
+				encoded.Inputs = append(encoded.Inputs, in)
+			}
+
+			for _, out := range tx.Outputs {
+				if hash, found := scriptHashes[string(out.ScriptHash)]; found && out.IsScriptHash() {
+					out.ScriptHash = hash
+				}
+
+				encoded.Outputs = append(encoded.Outputs, out)
+			}
+
+			encoded.SetID()
+			ids[string(tx.ID)] = encoded.ID
+			txs = append(txs, encoded)
+		}
+
+		mined := mineBlock(txs, prevHash, block.Height, block.Timestamp, chain.Params.Difficulty)
+		blocks = append(blocks, mined)
+		prevHash = mined.Hash
+	}
+
+	return replaceChain(chain, oldHashes, blocks, 3)
+}
+
+/*
+Redeem scripts were encoded with gob before version 3, but the blockchains of version 2 written after the change already have the fixed encoding
+*/
+func deserializeGobScript(data []byte) (*RedeemScript, error) {
+	if script, err := DeserializeScript(data); err == nil {
+		return script, nil
+	}
+
+	var script RedeemScript
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&script)
+
+	return &script, err
+}
+
+/*
+A block of the first versions of the program: the very first one stored a string in Data, the next one stored transactions instead.
+gob matches the fields by name, so the fields of both versions are decoded as they were written
+*/
+type firstLayoutBlock struct {
+	Hash         []byte
+	Data         []byte
+	Transactions []*firstLayoutTransaction
+	PrevHash     []byte
+	Nonce        int
+}
+
+type firstLayoutTransaction struct {
+	ID      []byte
+	Inputs  []firstLayoutInput
+	Outputs []firstLayoutOutput
+}
+
+type firstLayoutInput struct {
+	ID  []byte
+	Out int
+	Sig string
+}
+
+type firstLayoutOutput struct {
+	Value  int //Whole tokens
+	PubKey string
+}
+
+/*
+Converts the blocks of the first versions of the program (see firstLayout) and builds the UTXO set and the indexes:
+  - the blocks get their height, the time they were mined wasn't stored so their timestamp is 0
+  - a block with a Data string gets a coinbase transaction carrying the string in its input and paying nothing
+  - the values of the outputs were whole tokens, they are converted to the smallest unit (see UnitsPerCoin)
+  - the transaction IDs are computed from the fixed encoding and the inputs reference the new IDs
+
+Every block is mined again and the active chain is replaced (see replaceChain)
+*/
+func migrateFirstLayout(chain *Blockchain) error {
+	var old []*firstLayoutBlock
+	var oldHashes [][]byte
+
+	for hash := chain.LastHash(); len(hash) > 0; {
+		data, err := chain.Database.Get(hash)
+		if err != nil {
+			return fmt.Errorf("block %x: %v", hash, err)
+		}
+
+		var block firstLayoutBlock
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&block); err != nil {
+			return fmt.Errorf("block %x: %v", hash, err)
+		}
+
+		old = append(old, &block)
+		oldHashes = append(oldHashes, hash)
+		hash = block.PrevHash
+	}
+
+	slices.Reverse(old) //From the Genesis block
+	slices.Reverse(oldHashes)
+
+	ids := make(map[string][]byte) //old ID -> new ID
+	blocks := make([]*Block, 0, len(old))
+	prevHash := []byte{}
+
+	for height, block := range old {
+		var txs []*Transaction
+
+		if len(block.Transactions) == 0 {
+			coinbase := &Transaction{Inputs: []TxInput{{ID: []byte{}, Out: -1, Sig: string(block.Data)}}}
+			coinbase.SetID()
+			txs = append(txs, coinbase)
+		}
+
+		for _, tx := range block.Transactions {
+			converted := &Transaction{}
+
+			for _, in := range tx.Inputs {
+				id := in.ID
+				if len(in.ID) > 0 { //The input of a coinbase transaction references no transaction
+					var found bool
+					id, found = ids[string(in.ID)]
+					if !found {
+						return fmt.Errorf("transaction %x: output %s not found", tx.ID, formatOutpoint(in.ID, in.Out))
+					}
+				}
+
+				converted.Inputs = append(converted.Inputs, TxInput{ID: id, Out: in.Out, Sig: in.Sig})
+			}
+
+			for _, out := range tx.Outputs {
+				if out.Value <= 0 || uint64(out.Value) > uint64(math.MaxUint64/UnitsPerCoin) {
+					return fmt.Errorf("transaction %x: invalid value %d", tx.ID, out.Value)
+				}
+
+				converted.Outputs = append(converted.Outputs, TxOutput{Value: Amount(out.Value) * UnitsPerCoin, PubKey: out.PubKey})
+			}
+
+			converted.SetID()
+			ids[string(tx.ID)] = converted.ID
+			txs = append(txs, converted)
+		}
+
+		mined := mineBlock(txs, prevHash, height, 0, chain.Params.Difficulty)
+		blocks = append(blocks, mined)
+		prevHash = mined.Hash
+	}
+
+	return replaceChain(chain, oldHashes, blocks, SchemaVersion)
+}
+
+/*
+Replaces the active chain, whose blocks have the hashes 'old', with 'blocks' (from the Genesis block), whose hashes are all different.
+The new blocks and their undo data are written first, then the tip moves to the new last block in the update that writes 'version'
+and marks the indexes as stale: a migration interrupted before this update runs again on the old blocks, one interrupted after it
+only misses the rebuild of the UTXO set and the indexes, which LoadBlockchain does (see CheckConsistency).
+The old blocks, the side branches and the invalid marks, which reference old hashes, are deleted
+*/
+func replaceChain(chain *Blockchain, old [][]byte, blocks []*Block, version int) error {
+	replay := NewMemoryStore()
+	writer := chunkedWriter{store: chain.Database}
+
+	for _, block := range blocks {
+		if err := replayBlock(replay, block); err != nil {
+			return fmt.Errorf("block %d (%x): %v", block.Height, block.Hash, err)
+		}
+
+		if err := putBlock(writer.Set, block); err != nil {
+			return err
+		}
+	}
+
+	err := replay.Iterate(undoPrefix, writer.Set)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	var stale [][]byte
+	active := make(map[string]bool)
+
+	for _, block := range blocks { //A block whose transactions were already in the fixed encodings keeps its hash
+		active[string(block.Hash)] = true
+	}
+
+	for _, hash := range old {
+		if active[string(hash)] == false {
+			stale = append(stale, hash, undoKey(hash))
+		}
+		active[string(hash)] = true
+	}
+
+	err = chain.Database.Iterate(branchTipPrefix, func(key, value []byte) error {
+		for current := key[len(branchTipPrefix):]; active[string(current)] == false; {
+			header, err := getHeader(chain.Database.Get, current)
+			if err == ErrNotFound { //Already deleted with another branch
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			stale = append(stale, header.Hash, undoKey(header.Hash))
+			active[string(current)] = true //Not visited again by the branches that share this block
+			current = header.PrevHash
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tip := blocks[len(blocks)-1].Hash
+
+	err = chain.Database.Update(func(batch Batch) error {
+		if err := batch.Delete(indexesTipKey); err != nil {
+			return err
+		}
+
+		if err := setSchemaVersion(batch, version); err != nil {
+			return err
+		}
+
+		return batch.SetTip(tip)
+	})
+	if err != nil {
+		return err
+	}
+	chain.setLastHash(tip)
+
+	err = deleteKeys(chain.Database, stale)
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range [][]byte{branchTipPrefix, invalidPrefix} {
+		if err := chain.Database.DeleteByPrefix(prefix); err != nil {
+			return err
+		}
+	}
+
+	chain.Repair()
+
+	return nil
+}
+
+/*
+Deletes the keys in updates of at most writeChunkSize writes (see chunkedWriter)
+*/
+func deleteKeys(store Store, keys [][]byte) error {
+	for start := 0; start < len(keys); start += writeChunkSize {
+		end := start + writeChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		err := store.Update(func(batch Batch) error {
+			for _, key := range keys[start:end] {
+				if err := batch.Delete(key); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
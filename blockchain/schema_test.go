@@ -0,0 +1,358 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pierobassa/golang-blockchain/network"
+	"github.com/pierobassa/golang-blockchain/wallet"
+)
+
+/*
+Copy of the ./tmp/blocks directory of the first version of the program, which is part of the repository
+*/
+func copyFirstLayout(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	files, err := os.ReadDir(filepath.Join("..", "tmp", "blocks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join("..", "tmp", "blocks", file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, file.Name()), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestMigrateVersionZero(t *testing.T) {
+	chain := newTestChain(t)
+	chain.AddBlock("miner", []*Transaction{NewTransaction("alice", nil, "bob", 300, 0, chain)})
+	state := chainState(t, chain)
+
+	//Version 0 with a UTXO set: upgraded by every migration
+	err := chain.Database.Update(func(batch Batch) error {
+		return batch.Delete(schemaVersionKey)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadBlockchain(chain.Database, chain.Params); errors.Is(err, ErrSchemaVersion) == false {
+		t.Fatalf("LoadBlockchain() of version 0 = %v, want %v", err, ErrSchemaVersion)
+	}
+
+	done, err := Migrate(chain.Database, chain.Params, filepath.Join(t.TempDir(), "backup"), false, nil)
+	if err != nil || len(done) != len(migrations) {
+		t.Fatalf("Migrate() = %d migrations, %v, want every migration", len(done), err)
+	}
+
+	//The blockchain already had the fixed encodings, so nothing changes
+	migrated, err := LoadBlockchain(chain.Database, chain.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(migrated.LastHash(), chain.LastHash()) {
+		t.Fatalf("the last block is %x, want %x", migrated.LastHash(), chain.LastHash())
+	}
+	migratedState := chainState(t, migrated) //The replay also writes the (empty) undo data of the Genesis block
+	for key, value := range state {
+		if migratedState[key] != value {
+			t.Fatalf("key %q changed", key)
+		}
+	}
+}
+
+func TestMigrateTheFirstLayout(t *testing.T) {
+	dir := copyFirstLayout(t)
+	params := network.MainNet //The network of ./tmp/blocks
+
+	store, err := OpenBadgerStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if _, err := LoadBlockchain(store, &params); errors.Is(err, ErrSchemaVersion) == false {
+		t.Fatalf("LoadBlockchain() of the first layout = %v, want %v", err, ErrSchemaVersion)
+	}
+
+	backup := filepath.Join(t.TempDir(), "backup")
+
+	pending, err := Migrate(store, &params, backup, true, nil)
+	if err != nil || len(pending) != 1 || pending[0].Version != SchemaVersion || pending[0].Destructive == false {
+		t.Fatalf("Migrate() dry run = %+v, %v, want the conversion of the first layout", pending, err)
+	}
+
+	done, err := Migrate(store, &params, backup, false, nil)
+	if err != nil || len(done) != 1 {
+		t.Fatalf("Migrate() = %d migrations, %v, want the conversion of the first layout", len(done), err)
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Fatalf("no backup before the conversion: %v", err)
+	}
+
+	chain, err := LoadBlockchain(store, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := chain.CheckConsistency(); len(problems) > 0 {
+		t.Fatalf("inconsistent after the conversion: %q", problems)
+	}
+
+	report, err := chain.VerifyChain(0, VerifyUTXO)
+	if err != nil || report.Problem != nil {
+		t.Fatalf("VerifyChain() after the conversion = %+v, %v", report, err)
+	}
+
+	//The blocks of ./tmp/blocks only carried a string, now in the input of their coinbase transaction
+	for height, data := range []string{"Genesis", "First block after genesis", "Second block after genesis"} {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		coinbase := block.Transactions[0]
+		if len(block.Transactions) != 1 || coinbase.isCoinbase() == false || coinbase.Inputs[0].Sig != data || len(coinbase.Outputs) != 0 {
+			t.Fatalf("block %d = %v, want a coinbase transaction carrying %q", height, coinbase, data)
+		}
+	}
+	if chain.GetBestHeight() != 2 {
+		t.Fatalf("the last block has height %d, want 2", chain.GetBestHeight())
+	}
+
+	//The converted blockchain is extended like any other
+	chain.AddBlock("miner", nil)
+	if problems := chain.CheckConsistency(); len(problems) > 0 {
+		t.Fatalf("inconsistent after a new block: %q", problems)
+	}
+	if got := balance(chain, "miner"); got != Amount(params.Reward(3)) {
+		t.Fatalf("the miner has %s, want the reward of block 3", got)
+	}
+}
+
+/* -------------- ENCODINGS BEFORE VERSION 3 -------------- */
+
+func setGobID(tx *Transaction) {
+	var encoded bytes.Buffer
+
+	tx.ID = nil
+
+	err := gob.NewEncoder(&encoded).Encode(tx)
+	Handle(err)
+
+	hash := sha256.Sum256(encoded.Bytes())
+	tx.ID = hash[:]
+}
+
+func serializeGobScript(script *RedeemScript) []byte {
+	var encoded bytes.Buffer
+
+	err := gob.NewEncoder(&encoded).Encode(script)
+	Handle(err)
+
+	return encoded.Bytes()
+}
+
+/*
+Blockchain of version 2, whose transaction IDs and redeem script hashes come from gob:
+  - block 1: alice pays 300 and 100 to the script of bob and 50 to the script of dave, which is never revealed
+  - block 2: bob spends the 300 tokens revealing his script
+  - a side branch of one block on top of block 1, marked invalid
+
+@returns: the store, the parameters and the scripts of bob and dave
+*/
+func newVersion2Chain(t *testing.T) (Store, *network.ChainParams, *RedeemScript, *RedeemScript) {
+	t.Helper()
+
+	params := network.RegTest
+	store := NewMemoryStore()
+
+	bob := &RedeemScript{PubKey: "bob", RelativeLock: 1}
+	dave := &RedeemScript{PubKey: "dave"}
+	bobHash := wallet.PublicKeyHash(serializeGobScript(bob))
+	daveHash := wallet.PublicKeyHash(serializeGobScript(dave))
+
+	coinbase := CoinbaseTx("alice", params.GenesisData, Amount(params.Reward(0)))
+	setGobID(coinbase)
+	genesis := mineBlock([]*Transaction{coinbase}, []byte{}, 0, 1700000000, params.Difficulty)
+
+	payment := &Transaction{
+		Inputs: []TxInput{{ID: coinbase.ID, Out: 0, Sig: "alice"}},
+		Outputs: []TxOutput{
+			{Value: 300, ScriptHash: bobHash},
+			{Value: 100, ScriptHash: bobHash},
+			{Value: 50, ScriptHash: daveHash},
+			{Value: coinbase.Outputs[0].Value - 450, PubKey: "alice"},
+		},
+	}
+	setGobID(payment)
+	reward1 := CoinbaseTx("miner", "block 1", Amount(params.Reward(1)))
+	setGobID(reward1)
+	block1 := mineBlock([]*Transaction{reward1, payment}, genesis.Hash, 1, 1700000600, params.Difficulty)
+
+	spend := &Transaction{
+		Inputs:  []TxInput{{ID: payment.ID, Out: 0, Sig: "bob", Sequence: 1, RedeemScript: serializeGobScript(bob)}},
+		Outputs: []TxOutput{{Value: 300, PubKey: "carol"}},
+	}
+	setGobID(spend)
+	reward2 := CoinbaseTx("miner", "block 2", Amount(params.Reward(2)))
+	setGobID(reward2)
+	block2 := mineBlock([]*Transaction{reward2, spend}, block1.Hash, 2, 1700001200, params.Difficulty)
+
+	branchReward := CoinbaseTx("mallory", "branch", Amount(params.Reward(2)))
+	setGobID(branchReward)
+	branch := mineBlock([]*Transaction{branchReward}, block1.Hash, 2, 1700001200, params.Difficulty)
+
+	err := store.Update(func(batch Batch) error {
+		for _, block := range []*Block{genesis, block1, block2, branch} {
+			if err := batch.PutBlock(block); err != nil {
+				return err
+			}
+		}
+
+		if err := batch.Set(branchTipKey(branch.Hash), []byte{}); err != nil {
+			return err
+		}
+		if err := batch.Set(invalidKey(branch.Hash), []byte{}); err != nil {
+			return err
+		}
+		if err := setSchemaVersion(batch, 2); err != nil {
+			return err
+		}
+
+		return batch.SetTip(block2.Hash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := &Blockchain{lastHash: block2.Hash, Database: store, Params: &params}
+	chain.Repair()
+
+	return store, &params, bob, dave
+}
+
+func TestMigrateEncodings(t *testing.T) {
+	store, params, bob, dave := newVersion2Chain(t)
+	oldDaveHash := wallet.PublicKeyHash(serializeGobScript(dave))
+
+	done, err := Migrate(store, params, filepath.Join(t.TempDir(), "backup"), false, nil)
+	if err != nil || len(done) != 1 || done[0].Version != 3 {
+		t.Fatalf("Migrate() = %+v, %v, want the migration to version 3", done, err)
+	}
+
+	chain, err := LoadBlockchain(store, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := chain.VerifyChain(0, VerifyUTXO)
+	if err != nil || report.Problem != nil {
+		t.Fatalf("VerifyChain() after the migration = %+v, %v", report, err)
+	}
+
+	//Every ID and script is in the fixed encoding
+	for height := 0; height <= chain.GetBestHeight(); height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tx := range block.Transactions {
+			id := tx.ID
+			tx.SetID()
+			if !bytes.Equal(id, tx.ID) {
+				t.Fatalf("transaction %x of block %d isn't identified by its fixed encoding", id, height)
+			}
+
+			for _, in := range tx.Inputs {
+				if len(in.RedeemScript) > 0 && !bytes.Equal(in.RedeemScript, bob.Serialize()) {
+					t.Fatalf("the redeem script %x isn't in the fixed encoding", in.RedeemScript)
+				}
+			}
+		}
+	}
+
+	//The script of bob has been revealed: the output to the same address can be spent with the new encoding
+	if got := balance(chain, "carol"); got != 300 {
+		t.Fatalf("carol has %s, want 300", got)
+	}
+
+	tx := NewTransaction(bob.Address(params), bob, "erin", 100, 0, chain)
+	chain.AddBlock("miner", []*Transaction{tx})
+	if got := balance(chain, "erin"); got != 100 {
+		t.Fatalf("erin has %s, want the 100 tokens of the script of bob", got)
+	}
+
+	//The script of dave has never been revealed, so the output keeps the old hash
+	if outputs := (UTXOSet{chain}).FindUTXO(scriptHashAddress(oldDaveHash, params)); len(outputs) != 1 || outputs[0].Value != 50 {
+		t.Fatalf("the output to the script of dave = %+v, want the 50 tokens under the old hash", outputs)
+	}
+
+	//The side branch and its mark referenced the old hashes
+	for _, prefix := range [][]byte{branchTipPrefix, invalidPrefix} {
+		err := store.Iterate(prefix, func(key, value []byte) error {
+			t.Errorf("key %q left", key)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateEncodingsResumes(t *testing.T) {
+	//Interrupted before the tip moves to the new blocks: the migration runs again on the old blocks
+	store, params, _, _ := newVersion2Chain(t)
+
+	crash(t, func() {
+		Migrate(&crashingStore{store, tipKey}, params, filepath.Join(t.TempDir(), "backup"), false, nil)
+	})
+	if version, _ := GetSchemaVersion(store); version != 2 {
+		t.Fatalf("version %d after a crash before the tip moved, want 2", version)
+	}
+
+	done, err := Migrate(store, params, filepath.Join(t.TempDir(), "backup"), false, nil)
+	if err != nil || len(done) != 1 {
+		t.Fatalf("Migrate() after the crash = %+v, %v, want the migration to version 3", done, err)
+	}
+	want := chainState(t, &Blockchain{Database: store, Params: params})
+
+	//Interrupted while the UTXO set is rebuilt: the blocks are migrated and LoadBlockchain rebuilds the rest
+	store, params, _, _ = newVersion2Chain(t)
+
+	crash(t, func() {
+		Migrate(&crashingStore{store, utxoPrefix}, params, filepath.Join(t.TempDir(), "backup"), false, nil)
+	})
+	if pending, err := Migrate(store, params, "", true, nil); err != nil || len(pending) != 0 {
+		t.Fatalf("Migrate() dry run after a crash after the tip moved = %+v, %v, want nothing to do", pending, err)
+	}
+
+	chain, err := LoadBlockchain(store, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := chain.CheckConsistency(); len(problems) > 0 {
+		t.Fatalf("inconsistent after the repair: %q", problems)
+	}
+	if !reflect.DeepEqual(chainState(t, chain), want) {
+		t.Fatal("the resumed migration differs from an uninterrupted one")
+	}
+}
@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/pierobassa/golang-blockchain/network"
+	"github.com/pierobassa/golang-blockchain/wallet"
+)
+
+/*
+Pay-to-script-hash (P2SH) outputs don't store their spend conditions, they only commit to the hash of a redeem script.
+The recipient gives the sender an ordinary-looking address (the Base58Check encoding of the script hash)
+and reveals the redeem script only when spending the tokens.
+*/
+type RedeemScript struct {
+	PubKey       string //Account that can spend the tokens
+	RelativeLock int    //Number of blocks that must be mined after the output's block before the tokens can be spent
+}
+
+/*
+Hash the P2SH outputs commit to. It is the same HASH160 (SHA256 + RIPEMD160) used for the public keys
+*/
+func (s *RedeemScript) Hash() []byte {
+	return wallet.PublicKeyHash(s.Serialize())
+}
+
+/*
+@returns: the pay-to-script-hash address of the script on the network of 'params'
+*/
+func (s *RedeemScript) Address(params *network.ChainParams) string {
+	return scriptHashAddress(s.Hash(), params)
+}
+
+func scriptHashAddress(scriptHash []byte, params *network.ChainParams) string {
+	return string(wallet.ScriptHashAddress(scriptHash, params))
+}
+
+/*
+The spend conditions of the script expressed as an output holding 'value' tokens
+*/
+func (s *RedeemScript) Output(value Amount) TxOutput {
+	return TxOutput{Value: value, PubKey: s.PubKey, RelativeLock: s.RelativeLock}
+}
+
+/*
+Returns the spend conditions the input has to satisfy.
+For P2SH outputs they are the ones of the redeem script revealed by the input, which must match the script hash of the output.
+*/
+func (out *TxOutput) Conditions(in *TxInput) (TxOutput, error) {
+	if out.IsScriptHash() == false {
+		return *out, nil
+	}
+
+	script, err := DeserializeScript(in.RedeemScript)
+	if err != nil {
+		return TxOutput{}, fmt.Errorf("invalid redeem script: %v", err)
+	}
+
+	if bytes.Equal(script.Hash(), out.ScriptHash) == false {
+		return TxOutput{}, fmt.Errorf("redeem script doesn't match the script hash %x", out.ScriptHash)
+	}
+
+	return script.Output(out.Value), nil
+}
+
+func (out *TxOutput) IsScriptHash() bool {
+	return len(out.ScriptHash) > 0
+}
+
+/*
+Creates the output that locks 'value' tokens to 'address'.
+Pay-to-script-hash addresses (of the network of 'params') lock the tokens to the hash of their redeem script, any other address is used as the PubKey.
+The address of another network is refused (see wallet.CheckNetwork)
+*/
+func NewTxOutput(value Amount, address string, relativeLock int, params *network.ChainParams) TxOutput {
+	if err := wallet.CheckNetwork(address, params); err != nil {
+		log.Panicf("Error: %v!", err)
+	}
+
+	if scriptHash, ok := wallet.DecodeScriptHashAddress(address, params); ok {
+		if relativeLock > 0 {
+			log.Panic("Error: the relative lock of a pay-to-script-hash address is part of its redeem script!")
+		}
+
+		return TxOutput{Value: value, ScriptHash: scriptHash}
+	}
+
+	return TxOutput{Value: value, PubKey: address, RelativeLock: relativeLock}
+}
+
+/* -------------- SERIALIZATION & DESERIALIZATION -------------- */
+
+/*
+Fixed encoding of the script, so its hash is the same in every process (a gob encoding depends on what the process encoded before):
+the PubKey prefixed by its length (4 bytes) followed by the RelativeLock (8 bytes). The numbers are big endian
+*/
+func (s *RedeemScript) Serialize() []byte {
+	buf := appendBytes(nil, []byte(s.PubKey))
+
+	return binary.BigEndian.AppendUint64(buf, uint64(s.RelativeLock))
+}
+
+/*
+The redeem script comes from the spender so a malformed script returns an error instead of panicking
+*/
+func DeserializeScript(data []byte) (*RedeemScript, error) {
+	d := &recordDecoder{data: data}
+
+	pubKey := d.bytes()
+	relativeLock := int(int64(d.uint64()))
+
+	if d.err == nil && len(d.data) > 0 {
+		d.fail()
+	}
+
+	if d.err != nil {
+		return nil, errors.New("malformed encoding")
+	}
+
+	return &RedeemScript{string(pubKey), relativeLock}, nil
+}
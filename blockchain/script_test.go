@@ -0,0 +1,43 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+var testScript = RedeemScript{PubKey: "alice", RelativeLock: 3}
+
+/*
+The hash of a redeem script is its pay-to-script-hash address: it must never change, whatever the process encoded before
+*/
+func TestRedeemScriptHashIsStable(t *testing.T) {
+	const (
+		serialized = "00000005" + "616c696365" + "0000000000000003" //Length of the public key, public key, relative lock
+		hash       = "a231d0ae3e04ac3109f292814d8dca7a234c713e"
+	)
+
+	if got := hex.EncodeToString(testScript.Serialize()); got != serialized {
+		t.Fatalf("Serialize() = %s, want %s", got, serialized)
+	}
+
+	if got := hex.EncodeToString(testScript.Hash()); got != hash {
+		t.Fatalf("Hash() = %s, want %s", got, hash)
+	}
+}
+
+func TestDeserializeScript(t *testing.T) {
+	script, err := DeserializeScript(testScript.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *script != testScript {
+		t.Fatalf("DeserializeScript() = %+v, want %+v", *script, testScript)
+	}
+
+	for _, malformed := range [][]byte{nil, {0, 0, 0, 9, 'a'}, append(testScript.Serialize(), 0)} {
+		if _, err := DeserializeScript(malformed); err == nil {
+			t.Errorf("DeserializeScript(%x) accepted a malformed script", malformed)
+		}
+	}
+}
@@ -0,0 +1,876 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/pierobassa/golang-blockchain/network"
+)
+
+/*
+A UTXO snapshot is the UTXO set at a height, so a node can start from it instead of replaying every block:
+  - header: the magic bytes, the format version, the name of the network (1 byte of length + the name), the height (8 bytes)
+    and the serialized block at that height (4 bytes of length + the block)
+  - the number of transactions (8 bytes) followed by one record per transaction, in ascending ID order:
+    the length of the record (4 bytes) and the record (see encodeUTXOEntry)
+
+The content hash is the SHA256 of what the snapshot claims (see newSnapshotHasher): the name of the network, the height, the hash
+of the block and the records. It doesn't depend on how the set is stored, so it can be published and compared with the hash of the
+snapshot a node is given (see CheckHash): a trusted hash can't be reused for the same UTXO set at another block or on another network.
+All the numbers are big endian.
+*/
+var utxoSnapshotMagic = []byte("GBUS")
+
+const utxoSnapshotVersion = 2 //Version 1 didn't hash the network, the height and the hash of the block
+
+/*
+UTXO snapshot read from a file
+  - Network: name of the network
+  - Height, Block: height and block the UTXO set was taken at
+  - Hash: content hash of the UTXO set
+*/
+type UTXOSnapshot struct {
+	Network string
+	Height  int
+	Block   *Block
+	Hash    []byte
+
+	entries map[string]TxOutputs //transaction ID -> unspent outputs
+}
+
+/*
+@returns: the number of transactions with unspent outputs in the snapshot
+*/
+func (snapshot *UTXOSnapshot) Transactions() int {
+	return len(snapshot.entries)
+}
+
+/*
+Compares the content hash of the snapshot with the trusted one: the hash of the chain parameters for the height of the snapshot,
+or 'trusted' (hex) when the parameters have none. A 'trusted' hash can't override the one of the parameters.
+The content hash covers the network, the height and the block of the snapshot too, so they are checked by the comparison
+
+@returns: an error if there's no trusted hash, if 'trusted' isn't the configured hash or if the hashes don't match
+*/
+func (snapshot *UTXOSnapshot) CheckHash(params *network.ChainParams, trusted string) error {
+	if snapshot.Network != params.Name {
+		return fmt.Errorf("the snapshot is for the %s network, not %s", snapshot.Network, params.Name)
+	}
+
+	configured := params.AssumeUTXO[snapshot.Height]
+	if configured != "" && trusted != "" && trusted != configured {
+		return fmt.Errorf("the trusted hash %s isn't the hash configured for height %d (%s)", trusted, snapshot.Height, configured)
+	}
+
+	if trusted == "" {
+		trusted = configured
+	}
+
+	if trusted == "" {
+		return fmt.Errorf("no trusted hash is configured for a snapshot at height %d", snapshot.Height)
+	}
+
+	if trusted != hex.EncodeToString(snapshot.Hash) {
+		return fmt.Errorf("the snapshot hash %x doesn't match the trusted hash %s", snapshot.Hash, trusted)
+	}
+
+	return nil
+}
+
+/* -------------- DUMP -------------- */
+
+/*
+Writes the UTXO set at 'height' as a snapshot. The UTXO set of the last block is read from the store,
+the UTXO set at a lower height is replayed from the Genesis block
+
+@returns: the content hash and the number of transactions of the snapshot
+*/
+func (chain *Blockchain) DumpUTXO(w io.Writer, height int) ([]byte, int, error) {
+	chain.writeMu.Lock() //The UTXO set of the last block can't change while it's written
+	defer chain.writeMu.Unlock()
+
+	block, err := chain.GetBlockByHeight(height)
+	if err != nil {
+		return nil, 0, fmt.Errorf("block at height %d: %v", height, err)
+	}
+
+	var source Store = chain.Database
+
+	if bytes.Equal(block.Hash, chain.LastHash()) == false {
+		replay := NewMemoryStore()
+
+		iter, err := chain.RangeIterator(0, height)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for b := iter.Next(); b != nil; b = iter.Next() {
+			err = replayBlock(replay, b)
+			if err != nil {
+				return nil, 0, fmt.Errorf("block %d (%x): %v", b.Height, b.Hash, err)
+			}
+		}
+		if iter.Err() != nil {
+			return nil, 0, iter.Err()
+		}
+
+		source = replay
+	}
+
+	var records bytes.Buffer
+	count := 0
+
+	err = source.Iterate(utxoPrefix, func(key, value []byte) error {
+		records.Write(utxoRecord(key[prefixLength:], DeserializeOutputs(value)))
+		count++
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header := append(append([]byte{}, utxoSnapshotMagic...), utxoSnapshotVersion, byte(len(chain.Params.Name)))
+	header = append(header, chain.Params.Name...)
+	header = binary.BigEndian.AppendUint64(header, uint64(height))
+	header = appendBytes(header, block.Serialize())
+	header = binary.BigEndian.AppendUint64(header, uint64(count))
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header); err != nil {
+		return nil, 0, err
+	}
+	if _, err := bw.Write(records.Bytes()); err != nil {
+		return nil, 0, err
+	}
+
+	hasher := newSnapshotHasher(chain.Params.Name, height, block.Hash)
+	hasher.Write(records.Bytes())
+
+	return hasher.Sum(nil), count, bw.Flush()
+}
+
+/*
+SHA256 hasher of the content hash of a snapshot, fed with the name of the network, the height and the hash of the block
+(each variable length field prefixed by its length). The records of the UTXO set are written next
+*/
+func newSnapshotHasher(network string, height int, blockHash []byte) hash.Hash {
+	hasher := sha256.New()
+
+	buf := appendBytes(nil, []byte(network))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(height))
+	hasher.Write(appendBytes(buf, blockHash))
+
+	return hasher
+}
+
+/* -------------- LOAD -------------- */
+
+/*
+Reads a whole snapshot and computes its content hash. The snapshot isn't trusted until CheckHash succeeds
+*/
+func ReadUTXOSnapshot(r io.Reader) (*UTXOSnapshot, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(utxoSnapshotMagic)+2)
+	if _, err := io.ReadFull(br, header); err != nil || bytes.Equal(header[:len(utxoSnapshotMagic)], utxoSnapshotMagic) == false {
+		return nil, errors.New("not a UTXO snapshot")
+	}
+
+	if version := header[len(utxoSnapshotMagic)]; version != utxoSnapshotVersion {
+		return nil, fmt.Errorf("unsupported UTXO snapshot version %d", version)
+	}
+
+	name := make([]byte, header[len(utxoSnapshotMagic)+1])
+	if _, err := io.ReadFull(br, name); err != nil {
+		return nil, fmt.Errorf("truncated UTXO snapshot: %v", err)
+	}
+
+	snapshot := &UTXOSnapshot{Network: string(name), entries: make(map[string]TxOutputs)}
+
+	var height, count uint64
+	var blockLength uint32
+
+	if err := binary.Read(br, binary.BigEndian, &height); err != nil {
+		return nil, fmt.Errorf("truncated UTXO snapshot: %v", err)
+	}
+	snapshot.Height = int(height)
+
+	if err := binary.Read(br, binary.BigEndian, &blockLength); err != nil {
+		return nil, fmt.Errorf("truncated UTXO snapshot: %v", err)
+	}
+
+	data, err := readRecord(br, blockLength)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.Block = &Block{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(snapshot.Block); err != nil {
+		return nil, fmt.Errorf("corrupted UTXO snapshot: %v", err)
+	}
+
+	if snapshot.Block.Height != snapshot.Height {
+		return nil, fmt.Errorf("corrupted UTXO snapshot: the block has height %d instead of %d", snapshot.Block.Height, snapshot.Height)
+	}
+
+	if err := binary.Read(br, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("truncated UTXO snapshot: %v", err)
+	}
+
+	hasher := newSnapshotHasher(snapshot.Network, snapshot.Height, snapshot.Block.Hash)
+	var prevID []byte
+
+	for i := uint64(0); i < count; i++ {
+		var length uint32
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil {
+			return nil, fmt.Errorf("truncated UTXO snapshot: %v", err)
+		}
+
+		record, err := readRecord(br, length)
+		if err != nil {
+			return nil, err
+		}
+
+		txID, outs, err := decodeUTXOEntry(record)
+		if err != nil {
+			return nil, fmt.Errorf("corrupted UTXO snapshot: transaction %d: %v", i, err)
+		}
+
+		if prevID != nil && bytes.Compare(prevID, txID) >= 0 { //The order is part of the content hash
+			return nil, fmt.Errorf("corrupted UTXO snapshot: transaction %x is out of order", txID)
+		}
+		prevID = txID
+
+		hasher.Write(binary.BigEndian.AppendUint32(nil, length))
+		hasher.Write(record)
+
+		snapshot.entries[string(txID)] = outs
+	}
+
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("corrupted UTXO snapshot: unexpected data after the last transaction")
+	}
+
+	snapshot.Hash = hasher.Sum(nil)
+
+	return snapshot, nil
+}
+
+// Height, hash of the block and content hash of the snapshot a blockchain was started from, until the blocks below it are validated
+var snapshotKey = []byte("snapshot")
+
+// Returned when the blocks below the snapshot don't lead to its UTXO set: the blockchain started from it can't be used anymore
+var ErrInvalidSnapshot = errors.New("the blockchain was started from an invalid UTXO snapshot")
+
+type snapshotBase struct {
+	Height    int
+	BlockHash []byte
+	Hash      []byte
+
+	BlocksFile string //Bootstrap file the blocks below the snapshot are validated from (see SetSnapshotBlocks)
+	Validated  int    //Number of blocks below the snapshot already validated and stored
+	Invalid    bool   //The validation proved the snapshot invalid
+}
+
+/*
+Creates a blockchain in an empty store from a trusted snapshot (see CheckHash): the last block is the block of the snapshot
+and the UTXO set is the one of the snapshot. The blocks below it are missing until ValidateSnapshot adds them,
+so the commands that go through the whole blockchain fail until then
+
+@returns: the blockchain or an error if the store already has one
+*/
+func NewBlockchainFromSnapshot(store Store, snapshot *UTXOSnapshot, params *network.ChainParams) (*Blockchain, error) {
+	if _, err := store.GetTip(); err != ErrNotFound {
+		return nil, errors.New("the store already has a blockchain")
+	}
+
+	if snapshot.Network != params.Name {
+		return nil, fmt.Errorf("the snapshot is for the %s network, not %s", snapshot.Network, params.Name)
+	}
+
+	blockchain := Blockchain{lastHash: snapshot.Block.Hash, Database: store, Params: params}
+
+	//The link to the previous block can only be checked once the blocks below the snapshot are validated
+	err := blockchain.verifyBlock(snapshot.Block, snapshot.Height, snapshot.Block.PrevHash, VerifyTxIDs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block of the snapshot (%x): %v", snapshot.Block.Hash, err)
+	}
+
+	IDs := make([]string, 0, len(snapshot.entries))
+	for txID := range snapshot.entries {
+		IDs = append(IDs, txID)
+	}
+	sort.Strings(IDs)
+
+	//A Badger transaction can only hold a limited number of writes. The UTXO set is useless until the last hash is written
+	const chunkSize = 10000
+	for start := 0; start < len(IDs); start += chunkSize {
+		end := start + chunkSize
+		if end > len(IDs) {
+			end = len(IDs)
+		}
+
+		err := store.Update(func(batch Batch) error {
+			for _, txID := range IDs[start:end] {
+				err := batch.Set(utxoKey([]byte(txID)), snapshot.entries[txID].Serialize())
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	base := snapshotBase{Height: snapshot.Height, BlockHash: snapshot.Block.Hash, Hash: snapshot.Hash}
+
+	err = store.Update(func(batch Batch) error {
+		err := batch.PutBlock(snapshot.Block)
+		if err != nil {
+			return err
+		}
+
+		heightIndex := HeightIndex{}
+		heightIndex.ConnectBlock(batch, snapshot.Block)
+
+		err = setSnapshotBase(batch, base)
+		if err != nil {
+			return err
+		}
+
+		err = batch.Set(indexesTipKey, snapshot.Block.Hash)
+		if err != nil {
+			return err
+		}
+
+		err = setSchemaVersion(batch, SchemaVersion)
+		if err != nil {
+			return err
+		}
+
+		return batch.SetTip(snapshot.Block.Hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockchain, nil
+}
+
+/*
+Initializes a blockchain (if it isn't already present) in the Badger DB of the network from a trusted snapshot
+*/
+func InitBlockchainFromSnapshot(snapshot *UTXOSnapshot, params *network.ChainParams) *Blockchain {
+	//Check if DB already exists
+	if DBExists(params) {
+		fmt.Println("Blockchain already exists! A snapshot can only be loaded in a new blockchain")
+		runtime.Goexit()
+	}
+
+	err := os.MkdirAll(network.BlocksDir(params), 0755) //Badger only creates the last directory of the path
+	Handle(err)
+
+	store, err := OpenBadgerStore(network.BlocksDir(params))
+	Handle(err)
+
+	blockchain, err := NewBlockchainFromSnapshot(store, snapshot, params)
+	Handle(err)
+
+	return blockchain
+}
+
+/*
+@returns: the height of the snapshot the blockchain was started from and false if every block has been validated
+*/
+func (chain *Blockchain) SnapshotHeight() (int, bool) {
+	base, found := chain.snapshotBase()
+
+	return base.Height, found
+}
+
+func (chain *Blockchain) snapshotBase() (snapshotBase, bool) {
+	data, err := chain.Database.Get(snapshotKey)
+	if err == ErrNotFound {
+		return snapshotBase{}, false
+	}
+	Handle(err)
+
+	return decodeSnapshotBase(data), true
+}
+
+func decodeSnapshotBase(data []byte) snapshotBase {
+	var base snapshotBase
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&base)
+	Handle(err)
+
+	return base
+}
+
+func setSnapshotBase(batch Batch, base snapshotBase) error {
+	var encoded bytes.Buffer
+	err := gob.NewEncoder(&encoded).Encode(base)
+	Handle(err)
+
+	return batch.Set(snapshotKey, encoded.Bytes())
+}
+
+/*
+Writes a batch that changes the record of the snapshot while holding writeMu: connectBlock reads the record in its own transaction,
+so the two batches can't overlap (Badger would refuse one of them with a conflict)
+*/
+func (chain *Blockchain) updateSnapshot(fn func(batch Batch) error) error {
+	chain.writeMu.Lock()
+	defer chain.writeMu.Unlock()
+
+	return chain.Database.Update(fn)
+}
+
+/*
+Changes the record of the snapshot the blockchain was started from in a single batch
+
+@returns: an error if the blockchain wasn't started from a snapshot or if the batch fails
+*/
+func (chain *Blockchain) updateSnapshotBase(update func(base *snapshotBase)) error {
+	return chain.updateSnapshot(func(batch Batch) error {
+		data, err := batch.Get(snapshotKey)
+		if err == ErrNotFound {
+			return errors.New("the blockchain wasn't started from a snapshot")
+		}
+		if err != nil {
+			return err
+		}
+
+		base := decodeSnapshotBase(data)
+		update(&base)
+
+		return setSnapshotBase(batch, base)
+	})
+}
+
+/*
+Records the bootstrap file (see Export) the blocks below the snapshot are validated from by StartSnapshotValidation.
+The blocks already validated are kept: the validation resumes after them
+
+@returns: an error if the file isn't a bootstrap file of the network, if the blockchain wasn't started from a snapshot or if the snapshot is invalid
+*/
+func (chain *Blockchain) SetSnapshotBlocks(path string) error {
+	path, err := filepath.Abs(path) //The next commands can run in another directory
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	br, err := NewBootstrapReader(file)
+	if err != nil {
+		return err
+	}
+	if br.Network != chain.Params.Name {
+		return fmt.Errorf("the bootstrap file is for the %s network, not %s", br.Network, chain.Params.Name)
+	}
+
+	base, found := chain.snapshotBase()
+	if !found {
+		return errors.New("the blockchain wasn't started from a snapshot")
+	}
+	if base.Invalid {
+		return ErrInvalidSnapshot
+	}
+
+	return chain.updateSnapshotBase(func(base *snapshotBase) {
+		base.BlocksFile = path
+	})
+}
+
+// Returned by the validation of the snapshot when StopSnapshotValidation interrupts it
+var errValidationStopped = errors.New("the validation of the snapshot was stopped")
+
+// Validation of the blocks below the snapshot running in its own goroutine (see StartSnapshotValidation)
+type snapshotValidation struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+/*
+Validates the blocks below the snapshot in its own goroutine, so the blockchain can be used meanwhile,
+reading them from the file recorded by SetSnapshotBlocks. Every block validated is stored with the progress,
+so a validation stopped by StopSnapshotValidation (or Close) resumes from there when it's started again.
+'done' is called from the goroutine with the result of the validation, unless it is stopped.
+Does nothing if a validation is already running, if there's no file or if every block is validated
+
+@returns: an error if the recorded file can't be read
+*/
+func (chain *Blockchain) StartSnapshotValidation(done func(err error)) error {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	if chain.validation != nil {
+		return nil
+	}
+
+	base, found := chain.snapshotBase()
+	if !found || base.Invalid || base.BlocksFile == "" {
+		return nil
+	}
+
+	file, err := os.Open(base.BlocksFile)
+	if err != nil {
+		return err
+	}
+
+	br, err := NewBootstrapReader(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	validation := &snapshotValidation{make(chan struct{}), make(chan struct{})}
+	chain.validation = validation
+
+	go func() {
+		defer close(validation.done)
+		defer file.Close()
+
+		err := chain.validateSnapshot(br, nil, validation.stop)
+		if err != errValidationStopped {
+			done(err)
+		}
+	}()
+
+	return nil
+}
+
+/*
+Stops the validation started by StartSnapshotValidation and waits for it: the blocks validated so far are kept
+*/
+func (chain *Blockchain) StopSnapshotValidation() {
+	chain.mu.Lock()
+	validation := chain.validation
+	chain.validation = nil
+	chain.mu.Unlock()
+
+	if validation != nil {
+		close(validation.stop)
+		<-validation.done
+	}
+}
+
+/*
+Stops the validation of the snapshot running in the background and closes the store
+*/
+func (chain *Blockchain) Close() error {
+	chain.StopSnapshotValidation()
+
+	return chain.Database.Close()
+}
+
+/*
+Validates the blocks below the snapshot the blockchain was started from, reading them from a bootstrap file (see Export).
+Every block is checked like in VerifyChain against a UTXO set replayed in memory and stored with its height.
+The blocks validated by a previous run are only replayed, after checking that the file has the same ones.
+The block at the height of the snapshot must be the block of the snapshot and the replayed UTXO set must have the hash of the snapshot:
+only then the blockchain stops depending on the snapshot. Otherwise the snapshot is marked invalid (see ErrInvalidSnapshot).
+writeMu is only held while a validated block is written, so blocks can be added meanwhile.
+'progress' (optional) is called after every validated block
+
+@returns: an error if a block is invalid or if the snapshot doesn't match the blocks
+*/
+func (chain *Blockchain) ValidateSnapshot(br *BootstrapReader, progress func(height, total int)) error {
+	return chain.validateSnapshot(br, progress, nil)
+}
+
+/*
+ValidateSnapshot, stopped between two blocks when 'stop' is closed.
+When it fails the file is forgotten, so it isn't read again by StartSnapshotValidation
+*/
+func (chain *Blockchain) validateSnapshot(br *BootstrapReader, progress func(height, total int), stop <-chan struct{}) error {
+	err := chain.replaySnapshotBlocks(br, progress, stop)
+	if err == nil || err == errValidationStopped {
+		return err
+	}
+
+	if _, found := chain.snapshotBase(); found {
+		updateErr := chain.updateSnapshotBase(func(base *snapshotBase) {
+			base.BlocksFile = ""
+			base.Invalid = base.Invalid || errors.Is(err, ErrInvalidSnapshot)
+		})
+		Handle(updateErr)
+	}
+
+	return err
+}
+
+func (chain *Blockchain) replaySnapshotBlocks(br *BootstrapReader, progress func(height, total int), stop <-chan struct{}) error {
+	base, found := chain.snapshotBase()
+	if !found {
+		return errors.New("the blockchain wasn't started from a snapshot")
+	}
+	if base.Invalid {
+		return ErrInvalidSnapshot
+	}
+
+	if br.Network != chain.Params.Name {
+		return fmt.Errorf("the bootstrap file is for the %s network, not %s", br.Network, chain.Params.Name)
+	}
+
+	replay := NewMemoryStore()
+	findReplayed := func(txID []byte, outIdx int) (TxOutput, TxOutputs, bool) {
+		return findOutput(replay.Get, txID, outIdx)
+	}
+
+	var prevHash []byte
+	heightIndex := HeightIndex{chain}
+
+	for height := 0; height <= base.Height; height++ {
+		select {
+		case <-stop:
+			return errValidationStopped
+		default:
+		}
+
+		block, err := br.Next()
+		if err == io.EOF {
+			return fmt.Errorf("the bootstrap file ends before the height of the snapshot (%d)", base.Height)
+		}
+		if err != nil {
+			return err
+		}
+
+		if height < base.Validated {
+			validated, err := heightIndex.GetHash(height)
+			if err != nil {
+				return err
+			}
+
+			if bytes.Equal(block.Hash, validated) == false {
+				return fmt.Errorf("block %d of the file (%x) isn't the block already validated (%x)", height, block.Hash, validated)
+			}
+
+			err = replayBlock(replay, block)
+			if err != nil {
+				return fmt.Errorf("block %d (%x): %v", height, block.Hash, err)
+			}
+		} else {
+			err = chain.verifyBlock(block, height, prevHash, VerifyTransactions, findReplayed)
+			if err == nil {
+				err = replayBlock(replay, block)
+			}
+			if err != nil {
+				return fmt.Errorf("block %d (%x): %v", height, block.Hash, err)
+			}
+
+			if height < base.Height {
+				err = chain.updateSnapshot(func(batch Batch) error {
+					err := batch.PutBlock(block)
+					if err != nil {
+						return err
+					}
+
+					heightIndex.ConnectBlock(batch, block)
+
+					base.Validated = height + 1
+
+					return setSnapshotBase(batch, base)
+				})
+				if err != nil {
+					return err
+				}
+			} else if bytes.Equal(block.Hash, base.BlockHash) == false {
+				return fmt.Errorf("block %d of the file (%x) isn't the block of the snapshot (%x)", height, block.Hash, base.BlockHash)
+			}
+		}
+
+		prevHash = block.Hash
+
+		if progress != nil {
+			progress(height, base.Height)
+		}
+	}
+
+	hasher := newSnapshotHasher(chain.Params.Name, base.Height, base.BlockHash)
+	err := replay.Iterate(utxoPrefix, func(key, value []byte) error {
+		hasher.Write(utxoRecord(key[prefixLength:], DeserializeOutputs(value)))
+		return nil
+	})
+	Handle(err)
+
+	if hash := hasher.Sum(nil); bytes.Equal(hash, base.Hash) == false {
+		return fmt.Errorf("%w: the UTXO set replayed from the blocks (%x) doesn't match the snapshot (%x)", ErrInvalidSnapshot, hash, base.Hash)
+	}
+
+	return chain.updateSnapshot(func(batch Batch) error {
+		return batch.Delete(snapshotKey)
+	})
+}
+
+/* -------------- ENCODING OF THE RECORDS -------------- */
+
+/*
+Record of a transaction of the UTXO set: its ID, the height of its block, if it's a coinbase transaction
+and every unspent output in ascending index order (index followed by every field of TxOutput, see appendOutput).
+Variable length fields are prefixed by their length. A new field of TxOutput must be added to decodeUTXOEntry too
+*/
+func encodeUTXOEntry(txID []byte, outs TxOutputs) []byte {
+	buf := appendBytes(nil, txID)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(outs.Height))
+
+	if outs.Coinbase {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+
+	indexes := make([]int, 0, len(outs.Outputs))
+	for idx := range outs.Outputs {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(indexes)))
+	for _, idx := range indexes {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(idx))
+		buf = appendOutput(buf, outs.Outputs[idx])
+	}
+
+	return buf
+}
+
+/*
+Record prefixed by its length, as written in the snapshot and hashed
+*/
+func utxoRecord(txID []byte, outs TxOutputs) []byte {
+	return appendBytes(nil, encodeUTXOEntry(txID, outs))
+}
+
+func decodeUTXOEntry(record []byte) ([]byte, TxOutputs, error) {
+	d := &recordDecoder{data: record}
+
+	txID := d.bytes()
+	outs := TxOutputs{Outputs: make(map[int]TxOutput), Height: int(int64(d.uint64()))}
+
+	switch d.byte() {
+	case 0:
+	case 1:
+		outs.Coinbase = true
+	default:
+		d.fail()
+	}
+
+	count := int(d.uint32())
+	for i := 0; i < count && d.err == nil; i++ {
+		idx := int(d.uint32())
+
+		var out TxOutput
+		out.Value = Amount(d.uint64())
+		out.PubKey = string(d.bytes())
+		out.RelativeLock = int(int64(d.uint64()))
+		out.HashLock = d.bytes()
+		out.Refund = string(d.bytes())
+		out.LockTime = int(int64(d.uint64()))
+		out.Data = d.bytes()
+		out.ScriptHash = d.bytes()
+
+		outs.Outputs[idx] = out
+	}
+
+	if d.err == nil && len(d.data) > 0 {
+		d.fail()
+	}
+
+	if d.err != nil || len(txID) == 0 || len(outs.Outputs) != count || count == 0 {
+		return nil, TxOutputs{}, errors.New("invalid record")
+	}
+
+	return txID, outs, nil
+}
+
+/*
+Reads the fields of a record. After the first error every read returns a zero value
+*/
+type recordDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *recordDecoder) fail() {
+	d.err = errors.New("invalid record")
+	d.data = nil
+}
+
+func (d *recordDecoder) next(n int) []byte {
+	if d.err != nil || len(d.data) < n {
+		d.fail()
+		return make([]byte, n)
+	}
+
+	field := d.data[:n]
+	d.data = d.data[n:]
+
+	return field
+}
+
+func (d *recordDecoder) byte() byte {
+	return d.next(1)[0]
+}
+
+func (d *recordDecoder) uint32() uint32 {
+	return binary.BigEndian.Uint32(d.next(4))
+}
+
+func (d *recordDecoder) uint64() uint64 {
+	return binary.BigEndian.Uint64(d.next(8))
+}
+
+func (d *recordDecoder) bytes() []byte {
+	length := int(d.uint32())
+	if length > len(d.data) {
+		d.fail()
+		return nil
+	}
+
+	if length == 0 {
+		return nil //Empty fields are nil, like after a gob round trip
+	}
+
+	return append([]byte{}, d.next(length)...)
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+
+	return append(buf, b...)
+}
+
+func readRecord(r io.Reader, length uint32) ([]byte, error) {
+	if length == 0 || length > maxBootstrapBlock {
+		return nil, fmt.Errorf("corrupted UTXO snapshot: invalid record length %d", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("truncated UTXO snapshot: %v", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,264 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func dumpSnapshot(t *testing.T, chain *Blockchain, height int) ([]byte, *UTXOSnapshot) {
+	t.Helper()
+
+	var file bytes.Buffer
+	contentHash, _, err := chain.DumpUTXO(&file, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := ReadUTXOSnapshot(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return contentHash, snapshot
+}
+
+func TestSnapshotHashCoversTheHeader(t *testing.T) {
+	chain := newTestChain(t)
+	chain.AddBlock("miner", nil)
+
+	trusted, snapshot := dumpSnapshot(t, chain, 1)
+
+	if bytes.Equal(snapshot.Hash, trusted) == false {
+		t.Fatalf("ReadUTXOSnapshot() hash = %x, DumpUTXO() = %x", snapshot.Hash, trusted)
+	}
+
+	if err := snapshot.CheckHash(chain.Params, hex.EncodeToString(trusted)); err != nil {
+		t.Fatal(err)
+	}
+
+	//The same UTXO set on another network
+	params := *chain.Params
+	params.Name = "other"
+	chain.Params = &params
+
+	otherHash, other := dumpSnapshot(t, chain, 1)
+	if bytes.Equal(otherHash, trusted) || bytes.Equal(other.Hash, trusted) {
+		t.Fatal("the hash doesn't depend on the network")
+	}
+
+	if err := other.CheckHash(chain.Params, hex.EncodeToString(trusted)); err == nil {
+		t.Fatal("the trusted hash of another network was accepted")
+	}
+
+	//Same records at another height or block
+	base := newSnapshotHasher("regtest", 1, snapshot.Block.Hash).Sum(nil)
+	for _, hasher := range []hash.Hash{
+		newSnapshotHasher("regtest", 2, snapshot.Block.Hash),
+		newSnapshotHasher("regtest", 1, snapshot.Block.PrevHash),
+		newSnapshotHasher("regtes", 1, append([]byte("t"), snapshot.Block.Hash...)), //Fields are prefixed by their length
+	} {
+		if bytes.Equal(hasher.Sum(nil), base) {
+			t.Error("the hash doesn't depend on the height and the block")
+		}
+	}
+}
+
+func TestCheckHashPrefersTheConfiguredHash(t *testing.T) {
+	chain := newTestChain(t)
+	chain.AddBlock("miner", nil)
+
+	trusted, snapshot := dumpSnapshot(t, chain, 1)
+	other := hex.EncodeToString(bytes.Repeat([]byte{1}, len(trusted)))
+
+	params := *chain.Params
+	params.AssumeUTXO = map[int]string{1: hex.EncodeToString(trusted)}
+
+	for _, given := range []string{"", hex.EncodeToString(trusted)} {
+		if err := snapshot.CheckHash(&params, given); err != nil {
+			t.Errorf("CheckHash(configured, %q) = %v", given, err)
+		}
+	}
+
+	if err := snapshot.CheckHash(&params, other); err == nil {
+		t.Error("a hash given by the user overrode the configured hash")
+	}
+
+	//A snapshot whose hash isn't the configured one is refused even if the user trusts it
+	params.AssumeUTXO = map[int]string{1: other}
+	if err := snapshot.CheckHash(&params, hex.EncodeToString(trusted)); err == nil {
+		t.Error("a snapshot that doesn't match the configured hash was accepted")
+	}
+}
+
+/*
+Chain of 'blocks' blocks after the Genesis block, a blockchain in 'store' started from its snapshot at the height below the last block
+and the path of its bootstrap file
+*/
+func newSnapshotChain(t *testing.T, store Store, blocks int) (*Blockchain, *Blockchain, string) {
+	t.Helper()
+
+	source := newTestChain(t)
+	for i := 0; i < blocks; i++ {
+		source.AddBlock("miner", nil)
+	}
+
+	_, snapshot := dumpSnapshot(t, source, blocks-1)
+
+	chain, err := NewBlockchainFromSnapshot(store, snapshot, source.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "blocks.dat")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := source.Export(file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return source, chain, path
+}
+
+func TestValidateSnapshotResumes(t *testing.T) {
+	_, chain, path := newSnapshotChain(t, NewMemoryStore(), 4)
+
+	//Stopped after the first two blocks
+	stop := make(chan struct{})
+	err := chain.validateSnapshot(openBootstrap(t, path), func(height, total int) {
+		if height == 1 {
+			close(stop)
+		}
+	}, stop)
+	if err != errValidationStopped {
+		t.Fatalf("validateSnapshot() = %v, want it stopped", err)
+	}
+
+	if base, _ := chain.snapshotBase(); base.Validated != 2 {
+		t.Fatalf("%d blocks validated, want 2", base.Validated)
+	}
+
+	//Resumed in the background from the recorded file
+	if err := chain.SetSnapshotBlocks(path); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan error, 1)
+	if err := chain.StartSnapshotValidation(func(err error) { results <- err }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-results; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := chain.SnapshotHeight(); found {
+		t.Fatal("the snapshot wasn't validated")
+	}
+
+	for height := 0; height <= 3; height++ {
+		if _, err := chain.GetBlockByHeight(height); err != nil {
+			t.Errorf("block %d: %v", height, err)
+		}
+	}
+
+	if err := chain.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Run with -race: blocks are mined on a Badger store while the blocks below the snapshot are validated
+func TestSnapshotValidationWhileMining(t *testing.T) {
+	store, err := OpenBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, chain, path := newSnapshotChain(t, store, 40)
+	defer chain.Close()
+
+	if err := chain.SetSnapshotBlocks(path); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan error, 1)
+	err = chain.StartSnapshotValidation(func(err error) { results <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		chain.AddBlock("miner", nil) //Panics on a conflict with the writes of the validation
+	}
+
+	if err := <-results; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := chain.SnapshotHeight(); found {
+		t.Fatal("the snapshot wasn't validated")
+	}
+}
+
+func TestInvalidSnapshotIsRefused(t *testing.T) {
+	source, chain, path := newSnapshotChain(t, NewMemoryStore(), 4)
+
+	//A snapshot whose UTXO set isn't the one of its block, with a matching trusted hash
+	err := chain.updateSnapshotBase(func(base *snapshotBase) {
+		base.Hash = bytes.Repeat([]byte{1}, len(base.Hash))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := chain.SetSnapshotBlocks(path); err != nil {
+		t.Fatal(err)
+	}
+
+	err = chain.ValidateSnapshot(openBootstrap(t, path), nil)
+	if errors.Is(err, ErrInvalidSnapshot) == false {
+		t.Fatalf("ValidateSnapshot() = %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	if base, _ := chain.snapshotBase(); base.Invalid == false || base.BlocksFile != "" {
+		t.Fatalf("the snapshot isn't marked invalid: %+v", base)
+	}
+
+	next, err := source.GetBlockByHeight(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := chain.ImportBlock(next); errors.Is(err, ErrInvalidSnapshot) == false {
+		t.Errorf("ImportBlock() = %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	if _, err := LoadBlockchain(chain.Database, chain.Params); errors.Is(err, ErrInvalidSnapshot) == false {
+		t.Errorf("LoadBlockchain() = %v, want %v", err, ErrInvalidSnapshot)
+	}
+}
+
+func openBootstrap(t *testing.T, path string) *BootstrapReader {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+
+	br, err := NewBootstrapReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return br
+}
@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"errors"
+	"io"
+)
+
+/*
+A Store is the key-value storage of the blockchain: the blocks (stored under their hash), the last hash (tip)
+and every index (UTXO set, height, transaction and address indexes) under their own key prefix.
+
+Two implementations are available:
+  - BadgerStore: the Badger DB in the data directory
+  - MemoryStore: a map kept in memory, so the blockchain can be used (and tested) without touching the filesystem
+
+Another backend (ex: BoltDB or Pebble) only has to implement this interface.
+*/
+type Store interface {
+	GetBlock(hash []byte) (*Block, error) //ErrNotFound when there's no block with this hash, ErrPruned when only its header is left
+	PutBlock(block *Block) error
+	GetTip() ([]byte, error) //ErrNotFound when the store has no blockchain
+	SetTip(hash []byte) error
+
+	Get(key []byte) ([]byte, error) //ErrNotFound when the key doesn't exist
+
+	//Runs 'fn' with a batch of writes that are applied atomically once it returns.
+	//Nothing is written if 'fn' returns an error or if a key it read has been written by another update (ErrConflict)
+	Update(fn func(batch Batch) error) error
+
+	//Calls 'fn' with every key starting with 'prefix' (and its value) in ascending key order.
+	//Iteration stops at the first error, which is returned
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+
+	DeleteByPrefix(prefix []byte) error
+
+	//Gives the space of the deleted values (ex: pruned blocks) back to the filesystem when the backend needs it
+	CollectGarbage() error
+
+	//Writes every key and value to 'w' in the backup format of the backend
+	Backup(w io.Writer) error
+
+	Close() error
+}
+
+/*
+The writes of an atomic update. Get sees the writes already made in the batch
+*/
+type Batch interface {
+	Get(key []byte) ([]byte, error) //ErrNotFound when the key doesn't exist
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	PutBlock(block *Block) error
+	SetTip(hash []byte) error
+}
+
+var ErrNotFound = errors.New("key not found")
+
+// Returned by Update when a key read by 'fn' has been written by another update in the meantime. Nothing is written
+var ErrConflict = errors.New("the update read keys written by another update")
+
+// Returned for the blocks whose transactions have been deleted by the pruning (see Blockchain.Prune)
+var ErrPruned = errors.New("the block has been pruned, only its header is kept")
+
+// Key of the last hash (the tip of the blockchain). Blocks are stored under their hash
+var tipKey = []byte("lh")
+
+/* -------------- HELPERS SHARED BY THE IMPLEMENTATIONS -------------- */
+
+func getBlock(get func(key []byte) ([]byte, error), hash []byte) (*Block, error) {
+	block, err := getHeader(get, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(block.Transactions) == 0 { //Every block has at least one transaction
+		return nil, ErrPruned
+	}
+
+	return block, nil
+}
+
+/*
+Reads a block that may have been pruned: the transactions are missing when only its header is kept
+*/
+func getHeader(get func(key []byte) ([]byte, error), hash []byte) (*Block, error) {
+	data, err := get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return Deserialize(data), nil
+}
+
+func putBlock(set func(key, value []byte) error, block *Block) error {
+	return set(block.Hash, block.Serialize())
+}
+
+// Maximum number of writes of an update made by a chunkedWriter
+const writeChunkSize = 10000
+
+/*
+Applies many writes (ex: the rebuild of an index) in updates of at most writeChunkSize writes,
+as a Badger transaction can only hold a limited number of writes. The writes aren't atomic as a whole:
+a rebuild interrupted between two updates must be detectable (see markIndexesStale)
+*/
+type chunkedWriter struct {
+	store        Store
+	keys, values [][]byte
+}
+
+func (w *chunkedWriter) Set(key, value []byte) error {
+	w.keys = append(w.keys, key)
+	w.values = append(w.values, value)
+
+	if len(w.keys) == writeChunkSize {
+		return w.Flush()
+	}
+
+	return nil
+}
+
+/*
+Applies the writes that haven't been applied yet
+*/
+func (w *chunkedWriter) Flush() error {
+	if len(w.keys) == 0 {
+		return nil
+	}
+
+	err := w.store.Update(func(batch Batch) error {
+		for i := range w.keys {
+			if err := batch.Set(w.keys[i], w.values[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	w.keys, w.values = nil, nil
+
+	return err
+}
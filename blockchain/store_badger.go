@@ -0,0 +1,201 @@
+package blockchain
+
+import (
+	"io"
+
+	"github.com/dgraph-io/badger"
+)
+
+/*
+Store backed by a Badger DB
+*/
+type BadgerStore struct {
+	db *badger.DB
+}
+
+/*
+Opens (or creates) the Badger DB in 'dir'
+*/
+func OpenBadgerStore(dir string) (*BadgerStore, error) {
+	opts := badger.DefaultOptions(dir) //DefaultOptions sets a list of recommended options for good performance.
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BadgerStore{db}, nil
+}
+
+func (s *BadgerStore) GetBlock(hash []byte) (*Block, error) {
+	return getBlock(s.Get, hash)
+}
+
+func (s *BadgerStore) PutBlock(block *Block) error {
+	return s.Update(func(batch Batch) error {
+		return batch.PutBlock(block)
+	})
+}
+
+func (s *BadgerStore) GetTip() ([]byte, error) {
+	return s.Get(tipKey)
+}
+
+func (s *BadgerStore) SetTip(hash []byte) error {
+	return s.Update(func(batch Batch) error {
+		return batch.SetTip(hash)
+	})
+}
+
+func (s *BadgerStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		value, err = badgerGet(txn, key)
+
+		return err
+	})
+
+	return value, err
+}
+
+func (s *BadgerStore) Update(fn func(batch Batch) error) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return fn(badgerBatch{txn})
+	})
+	if err == badger.ErrConflict {
+		return ErrConflict
+	}
+
+	return err
+}
+
+func (s *BadgerStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			err = fn(item.KeyCopy(nil), value)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+Deletes the keys in chunks, as a Badger transaction can only hold a limited number of writes
+*/
+func (s *BadgerStore) DeleteByPrefix(prefix []byte) error {
+	deleteKeys := func(keysForDelete [][]byte) error {
+		return s.db.Update(func(txn *badger.Txn) error {
+			for _, key := range keysForDelete {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	collectSize := 100000
+	return s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		keysForDelete := make([][]byte, 0, collectSize)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keysForDelete = append(keysForDelete, it.Item().KeyCopy(nil))
+			if len(keysForDelete) == collectSize {
+				if err := deleteKeys(keysForDelete); err != nil {
+					return err
+				}
+				keysForDelete = make([][]byte, 0, collectSize)
+			}
+		}
+		if len(keysForDelete) > 0 {
+			return deleteKeys(keysForDelete)
+		}
+		return nil
+	})
+}
+
+/*
+Rewrites the value log files that are mostly made of deleted or overwritten values until none is left.
+Badger never reclaims that space on its own
+*/
+func (s *BadgerStore) CollectGarbage() error {
+	for {
+		err := s.db.RunValueLogGC(0.5)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected { //Nothing left to rewrite, or a collection is already running
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+/*
+Full backup of the DB, which the badger tool restores with 'badger restore'
+*/
+func (s *BadgerStore) Backup(w io.Writer) error {
+	_, err := s.db.Backup(w, 0)
+	return err
+}
+
+func (s *BadgerStore) Close() error {
+	return s.db.Close()
+}
+
+/*
+A batch of a BadgerStore is a read-write Badger transaction
+*/
+type badgerBatch struct {
+	txn *badger.Txn
+}
+
+func (b badgerBatch) Get(key []byte) ([]byte, error) {
+	return badgerGet(b.txn, key)
+}
+
+func (b badgerBatch) Set(key, value []byte) error {
+	return b.txn.Set(key, value)
+}
+
+func (b badgerBatch) Delete(key []byte) error {
+	return b.txn.Delete(key)
+}
+
+func (b badgerBatch) PutBlock(block *Block) error {
+	return putBlock(b.Set, block)
+}
+
+func (b badgerBatch) SetTip(hash []byte) error {
+	return b.Set(tipKey, hash)
+}
+
+func badgerGet(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
@@ -0,0 +1,203 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"sort"
+	"sync"
+)
+
+/*
+Store kept in memory. Nothing is written to disk, so it's meant for tests and throwaway chains.
+The writes of an update are collected in the batch and applied together, so readers never see half of an update.
+Like a Badger transaction, an update fails with ErrConflict if a key it read has been written by another update in the meantime.
+*/
+type MemoryStore struct {
+	mu       sync.RWMutex
+	data     map[string][]byte
+	version  uint64            //Number of applied updates
+	modified map[string]uint64 //Version of the last update that wrote or deleted each key
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte), modified: make(map[string]uint64)}
+}
+
+func (s *MemoryStore) GetBlock(hash []byte) (*Block, error) {
+	return getBlock(s.Get, hash)
+}
+
+func (s *MemoryStore) PutBlock(block *Block) error {
+	return s.Update(func(batch Batch) error {
+		return batch.PutBlock(block)
+	})
+}
+
+func (s *MemoryStore) GetTip() ([]byte, error) {
+	return s.Get(tipKey)
+}
+
+func (s *MemoryStore) SetTip(hash []byte) error {
+	return s.Update(func(batch Batch) error {
+		return batch.SetTip(hash)
+	})
+}
+
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+/*
+'fn' runs without holding the lock, so it can read the store (ex: through the UTXO set) while preparing the writes.
+The keys read through the batch are checked before the writes are applied: the update fails with ErrConflict
+if one of them has been written since the update started, as 'fn' may have decided on a stale value (ex: the last hash)
+*/
+func (s *MemoryStore) Update(fn func(batch Batch) error) error {
+	s.mu.RLock()
+	start := s.version
+	s.mu.RUnlock()
+
+	batch := &memoryBatch{store: s, writes: make(map[string][]byte), reads: make(map[string]bool)}
+
+	err := fn(batch)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range batch.reads {
+		if s.modified[key] > start {
+			return ErrConflict
+		}
+	}
+
+	s.version++
+
+	for key, value := range batch.writes {
+		if value == nil {
+			delete(s.data, key)
+		} else {
+			s.data[key] = value
+		}
+		s.modified[key] = s.version
+	}
+
+	return nil
+}
+
+/*
+Iterates over a snapshot of the matching keys, so 'fn' can update the store
+*/
+func (s *MemoryStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+
+	var keys []string
+	for key := range s.data {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys) //Same order as Badger: ascending bytes
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = append([]byte{}, s.data[key]...)
+	}
+
+	s.mu.RUnlock()
+
+	for i, key := range keys {
+		err := fn([]byte(key), values[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteByPrefix(prefix []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version++
+
+	for key := range s.data {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			delete(s.data, key)
+			s.modified[key] = s.version
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) CollectGarbage() error {
+	return nil //Deleted keys are already gone from the map
+}
+
+/*
+Writes the map of the keys and values with gob
+*/
+func (s *MemoryStore) Backup(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return gob.NewEncoder(w).Encode(s.data)
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+/*
+Writes of an update of a MemoryStore. A nil value marks a deleted key
+*/
+type memoryBatch struct {
+	store  *MemoryStore
+	writes map[string][]byte
+	reads  map[string]bool //Keys read from the store, checked for conflicts when the update is applied
+}
+
+func (b *memoryBatch) Get(key []byte) ([]byte, error) {
+	if value, ok := b.writes[string(key)]; ok {
+		if value == nil {
+			return nil, ErrNotFound
+		}
+
+		return append([]byte{}, value...), nil
+	}
+
+	b.reads[string(key)] = true
+
+	return b.store.Get(key)
+}
+
+func (b *memoryBatch) Set(key, value []byte) error {
+	b.writes[string(key)] = append([]byte{}, value...) //Never nil, even for an empty value
+	return nil
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	b.writes[string(key)] = nil
+	return nil
+}
+
+func (b *memoryBatch) PutBlock(block *Block) error {
+	return putBlock(b.Set, block)
+}
+
+func (b *memoryBatch) SetTip(hash []byte) error {
+	return b.Set(tipKey, hash)
+}
@@ -0,0 +1,188 @@
+package blockchain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+/*
+Runs 'test' with a Badger store in a temporary directory and with a memory store
+*/
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("badger", func(t *testing.T) {
+		store, err := OpenBadgerStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+
+		test(t, store)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+}
+
+func TestStoreUpdateIsAtomic(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		err := store.Update(func(batch Batch) error {
+			return batch.Set([]byte("kept"), []byte("1"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		failure := errors.New("failure")
+		err = store.Update(func(batch Batch) error {
+			if err := batch.Set([]byte("kept"), []byte("2")); err != nil {
+				return err
+			}
+			if err := batch.Set([]byte("added"), []byte("1")); err != nil {
+				return err
+			}
+
+			//The batch sees its own writes
+			if value, err := batch.Get([]byte("kept")); err != nil || string(value) != "2" {
+				t.Errorf("Batch.Get() = %q, %v, want the value written in the batch", value, err)
+			}
+
+			if err := batch.Delete([]byte("kept")); err != nil {
+				return err
+			}
+			if _, err := batch.Get([]byte("kept")); err != ErrNotFound {
+				t.Errorf("Batch.Get() of a deleted key = %v, want %v", err, ErrNotFound)
+			}
+
+			return failure
+		})
+		if err != failure {
+			t.Fatalf("Update() = %v, want the error of fn", err)
+		}
+
+		if value, err := store.Get([]byte("kept")); err != nil || string(value) != "1" {
+			t.Errorf("Get() = %q, %v after a failed update, want the previous value", value, err)
+		}
+		if _, err := store.Get([]byte("added")); err != ErrNotFound {
+			t.Errorf("Get() = %v for a key of a failed update, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestStoreIterate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		err := store.Update(func(batch Batch) error {
+			for _, key := range []string{"p-2", "q-1", "p-10", "p", "p-1", "o-1"} {
+				if err := batch.Set([]byte(key), []byte("value of "+key)); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var keys []string
+		err = store.Iterate([]byte("p-"), func(key, value []byte) error {
+			if string(value) != "value of "+string(key) {
+				t.Errorf("the value of %q is %q", key, value)
+			}
+			keys = append(keys, string(key))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []string{"p-1", "p-10", "p-2"}; reflect.DeepEqual(keys, want) == false {
+			t.Errorf("Iterate() went through %q, want %q", keys, want)
+		}
+
+		//The first error stops the iteration
+		stop := errors.New("stop")
+		calls := 0
+		err = store.Iterate([]byte("p-"), func(key, value []byte) error {
+			calls++
+			return stop
+		})
+		if err != stop || calls != 1 {
+			t.Errorf("Iterate() = %v after %d calls, want the error of fn after 1 call", err, calls)
+		}
+	})
+}
+
+func TestStoreNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		if _, err := store.Get([]byte("missing")); err != ErrNotFound {
+			t.Errorf("Get() = %v, want %v", err, ErrNotFound)
+		}
+
+		if _, err := store.GetTip(); err != ErrNotFound {
+			t.Errorf("GetTip() of an empty store = %v, want %v", err, ErrNotFound)
+		}
+
+		if _, err := store.GetBlock([]byte("missing")); err != ErrNotFound {
+			t.Errorf("GetBlock() = %v, want %v", err, ErrNotFound)
+		}
+
+		err := store.Update(func(batch Batch) error {
+			_, err := batch.Get([]byte("missing"))
+			return err
+		})
+		if err != ErrNotFound {
+			t.Errorf("Batch.Get() = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestStoreUpdateConflict(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		err := store.Update(func(batch Batch) error {
+			return batch.Set([]byte("read"), []byte("1"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.Update(func(batch Batch) error {
+			if _, err := batch.Get([]byte("read")); err != nil {
+				return err
+			}
+
+			//Another update writes the key that was read
+			err := store.Update(func(other Batch) error {
+				return other.Set([]byte("read"), []byte("2"))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return batch.Set([]byte("written"), []byte("1"))
+		})
+		if err != ErrConflict {
+			t.Fatalf("Update() = %v, want %v", err, ErrConflict)
+		}
+
+		if _, err := store.Get([]byte("written")); err != ErrNotFound {
+			t.Errorf("Get() = %v for a key of a conflicting update, want %v", err, ErrNotFound)
+		}
+
+		//Writing a key that wasn't read isn't a conflict
+		err = store.Update(func(batch Batch) error {
+			err := store.Update(func(other Batch) error {
+				return other.Set([]byte("read"), []byte("3"))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return batch.Set([]byte("read"), []byte("4"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -1,12 +1,11 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/sha256"
-	"encoding/gob"
-	"encoding/hex"
+	"encoding/binary"
 	"fmt"
 	"log"
+	"strings"
 )
 
 type Transaction struct {
@@ -18,31 +17,27 @@ type Transaction struct {
 /*
 Sets the ID for the given Transaction
 
-Creates a hash based on the bytes that represent the transaction
+Creates a hash based on the bytes that represent the transaction (see Serialize)
 */
 func (tx *Transaction) SetID() {
-	var encoded bytes.Buffer
 	var hash [32]byte
 
-	encode := gob.NewEncoder(&encoded)
-	err := encode.Encode(tx)
-	Handle(err)
-
-	hash = sha256.Sum256(encoded.Bytes())
+	hash = sha256.Sum256(tx.Serialize())
 
 	tx.ID = hash[:]
 }
 
 /*
-Coinbase transaction is the first transaction which Input references an empty output because there is no previous transaction
+Coinbase transaction is the first transaction which Input references an empty output because there is no previous transaction.
+It pays 'reward' tokens, which must follow the reward schedule of the chain (see network.ChainParams)
 */
-func CoinbaseTx(to, data string) *Transaction {
+func CoinbaseTx(to, data string, reward Amount) *Transaction {
 	if data == "" {
 		data = fmt.Sprintf("Coins to %s", to)
 	}
 
-	txin := TxInput{[]byte{}, -1, data} //Empty output, -1 as index because there is no output referenced
-	txout := TxOutput{100, to}          //100 tokens in output
+	txin := TxInput{ID: []byte{}, Out: -1, Sig: data} //Empty output, -1 as index because there is no output referenced
+	txout := TxOutput{Value: reward, PubKey: to}
 
 	tx := Transaction{nil, []TxInput{txin}, []TxOutput{txout}}
 	tx.SetID() //create the hash id for the transaction
@@ -54,42 +49,238 @@ func CoinbaseTx(to, data string) *Transaction {
 Creates a new Transaction which is not a Coinbase transaction
 
 @param: from -> from account
+@param: script -> redeem script of 'from' when it is a pay-to-script-hash address (nil otherwise)
 @param: to -> to account
 @param: amount -> amount of tokens transafered from 'from' to 'to'
+@param: relativeLock -> number of blocks 'to' has to wait after the transaction is confirmed before spending the tokens (0 for no lock)
 @param: chain -> the pointer to the blockchain
 */
-func NewTransaction(from string, to string, amount int, chain *Blockchain) *Transaction {
-	var inputs []TxInput
-	var outputs []TxOutput
+func NewTransaction(from string, script *RedeemScript, to string, amount Amount, relativeLock int, chain *Blockchain) *Transaction {
+	tx, _ := NewPaymentsTransaction(from, script, []Payment{{to, amount, relativeLock}}, nil, chain)
 
-	accumulator, validOutputs := chain.FindSpendableOutputs(from, amount)
+	return tx
+}
 
-	if accumulator < amount {
-		log.Panic("Error: not enough funds!")
-	}
+/*
+A single output of a transaction: 'Amount' tokens to 'Address'
+*/
+type Payment struct {
+	Address      string
+	Amount       Amount
+	RelativeLock int //Number of blocks 'Address' has to wait after the transaction is confirmed before spending the tokens (0 for no lock)
+}
 
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		Handle(err)
+/*
+Creates a new Transaction that pays every recipient in 'payments' with the tokens of 'from'.
+The outputs follow the order of the payments and the change (if any) is the last output.
+With BranchAndBound an excess up to ChangeCost is left to the miner as a fee instead of creating a change output,
+the other strategies give any excess back to 'from'.
 
-		for _, out := range outs {
-			input := TxInput{txID, out, from}
-			inputs = append(inputs, input)
+@param: from -> from account
+@param: script -> redeem script of 'from' when it is a pay-to-script-hash address (nil otherwise)
+@param: payments -> recipients and amounts
+@param: selector -> coin selection strategy (LargestFirst when nil)
+@param: chain -> the pointer to the blockchain
+
+@returns: the transaction and the waste of the coin selection (see Waste)
+*/
+func NewPaymentsTransaction(from string, script *RedeemScript, payments []Payment, selector CoinSelector, chain *Blockchain) (*Transaction, Amount) {
+	var outputs []TxOutput
+
+	if len(payments) == 0 {
+		log.Panic("Error: a transaction needs at least one payment!")
+	}
+
+	var amount Amount
+	for _, payment := range payments {
+		if payment.Amount == 0 {
+			log.Panicf("Error: invalid amount %s for %s!", payment.Amount, payment.Address)
 		}
+
+		var err error
+		amount, err = amount.Add(payment.Amount)
+		Handle(err)
+		outputs = append(outputs, NewTxOutput(payment.Amount, payment.Address, payment.RelativeLock, chain.Params))
 	}
 
-	outputs = append(outputs, TxOutput{amount, to})
+	inputs, accumulator, waste := spendInputs(from, script, amount, selector, chain)
+
+	outputs = appendChange(outputs, from, accumulator-amount, selector, chain)
+
+	tx := Transaction{nil, inputs, outputs}
+	tx.SetID()
+
+	return &tx, waste
+}
 
-	if accumulator > amount {
-		outputs = append(outputs, TxOutput{accumulator - amount, from}) //Returning the excess amount back to the 'from' account
+/*
+Creates a Transaction that writes 'data' in a data output.
+The transaction spends an output of 'from' and gives all the tokens back as change, so it is unique and paid by a real account.
+*/
+func NewDataTransaction(from string, data []byte, chain *Blockchain) *Transaction {
+	if len(data) == 0 || len(data) > MaxDataSize {
+		log.Panicf("Error: a data output can carry from 1 to %d bytes!", MaxDataSize)
 	}
 
+	inputs, accumulator, _ := spendInputs(from, nil, 1, SmallestFirst{}, chain) //Any spendable output is enough (1 unit), the smallest one is used
+
+	outputs := []TxOutput{{Data: data}, NewTxOutput(accumulator, from, 0, chain.Params)}
+
 	tx := Transaction{nil, inputs, outputs}
 	tx.SetID()
 
 	return &tx
 }
 
+/*
+Builds the inputs that spend enough outputs of 'from' to cover 'amount', chosen by 'selector' (LargestFirst when nil).
+When 'from' is a pay-to-script-hash address the inputs reveal its redeem script and are signed by the PubKey of the script
+
+@returns: the inputs, the total amount of the outputs they spend and the waste of the selection
+*/
+func spendInputs(from string, script *RedeemScript, amount Amount, selector CoinSelector, chain *Blockchain) ([]TxInput, Amount, Amount) {
+	var inputs []TxInput
+	var redeemScript []byte
+
+	sig := from
+	if script != nil {
+		if script.Address(chain.Params) != from {
+			log.Panic("Error: the redeem script doesn't match the address!")
+		}
+
+		sig = script.PubKey
+		redeemScript = script.Serialize()
+	}
+
+	UTXOSet := UTXOSet{chain}
+	selected, err := UTXOSet.FindSpendableOutputs(from, amount, selector)
+
+	if err != nil {
+		log.Panic("Error: not enough funds!")
+	}
+
+	for _, spendable := range selected {
+		sequence := spendable.Output.RelativeLock //The sequence must cover the relative lock of the output we are spending
+		if script != nil {
+			sequence = script.RelativeLock
+		}
+
+		input := TxInput{ID: spendable.TxID, Out: spendable.Index, Sig: sig, Sequence: sequence, RedeemScript: redeemScript}
+		inputs = append(inputs, input)
+	}
+
+	return inputs, totalValue(selected), selectionWaste(selected, amount, selector)
+}
+
+/*
+Appends the output returning the excess of the inputs to 'from', unless 'selector' leaves it to the miner (see leavesExcessToMiner)
+*/
+func appendChange(outputs []TxOutput, from string, excess Amount, selector CoinSelector, chain *Blockchain) []TxOutput {
+	if excess == 0 || (excess <= ChangeCost && leavesExcessToMiner(selector)) {
+		return outputs
+	}
+
+	return append(outputs, NewTxOutput(excess, from, 0, chain.Params)) //Returning the excess amount back to the 'from' account
+}
+
+/*
+Human readable representation of the transaction: every input and output with its fields
+*/
+func (tx Transaction) String() string {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
+
+	for i, input := range tx.Inputs {
+		lines = append(lines, fmt.Sprintf("     Input %d:", i))
+		lines = append(lines, fmt.Sprintf("       TXID:     %x", input.ID))
+		lines = append(lines, fmt.Sprintf("       Out:      %d", input.Out))
+		lines = append(lines, fmt.Sprintf("       Sig:      %s", input.Sig))
+		lines = append(lines, fmt.Sprintf("       Sequence: %d", input.Sequence))
+		if len(input.Preimage) > 0 {
+			lines = append(lines, fmt.Sprintf("       Preimage: %x", input.Preimage))
+		}
+		if len(input.RedeemScript) > 0 {
+			lines = append(lines, fmt.Sprintf("       Script:   %x", input.RedeemScript))
+		}
+	}
+
+	for i, output := range tx.Outputs {
+		lines = append(lines, fmt.Sprintf("     Output %d:", i))
+		lines = append(lines, fmt.Sprintf("       Value:    %s", output.Value))
+
+		switch {
+		case output.IsData():
+			lines = append(lines, fmt.Sprintf("       Data:     %x", output.Data))
+		case output.IsScriptHash():
+			lines = append(lines, fmt.Sprintf("       Script:   %x", output.ScriptHash))
+		case output.IsHTLC():
+			lines = append(lines, fmt.Sprintf("       PubKey:   %s", output.PubKey))
+			lines = append(lines, fmt.Sprintf("       HashLock: %x", output.HashLock))
+			lines = append(lines, fmt.Sprintf("       Refund:   %s from height %d", output.Refund, output.LockTime))
+		default:
+			lines = append(lines, fmt.Sprintf("       PubKey:   %s", output.PubKey))
+		}
+
+		if output.RelativeLock > 0 {
+			lines = append(lines, fmt.Sprintf("       Lock:     %d blocks", output.RelativeLock))
+		}
+		if output.IsHTLC() == false && output.LockTime > 0 {
+			lines = append(lines, fmt.Sprintf("       Vesting:  until height %d", output.LockTime))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+/*
+Fixed encoding of the transaction, which its ID is the hash of. A gob encoding can't be used: it depends on what the process encoded before.
+  - the number of inputs (4 bytes), then every field of every input (see appendInput)
+  - the number of outputs (4 bytes), then every field of every output (see appendOutput)
+
+The ID itself isn't part of the encoding. A new field of TxInput or TxOutput must be added to appendInput or appendOutput too
+
+@returns: slice of bytes representing the serialization of the transaction
+*/
+func (tx *Transaction) Serialize() []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		buf = appendInput(buf, in)
+	}
+
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		buf = appendOutput(buf, out)
+	}
+
+	return buf
+}
+
+/*
+Variable length fields are prefixed by their length (4 bytes), the numbers take 8 bytes. All the numbers are big endian
+*/
+func appendInput(buf []byte, in TxInput) []byte {
+	buf = appendBytes(buf, in.ID)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(in.Out))
+	buf = appendBytes(buf, []byte(in.Sig))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(in.Sequence))
+	buf = appendBytes(buf, in.Preimage)
+
+	return appendBytes(buf, in.RedeemScript)
+}
+
+func appendOutput(buf []byte, out TxOutput) []byte {
+	buf = binary.BigEndian.AppendUint64(buf, uint64(out.Value))
+	buf = appendBytes(buf, []byte(out.PubKey))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(out.RelativeLock))
+	buf = appendBytes(buf, out.HashLock)
+	buf = appendBytes(buf, []byte(out.Refund))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(out.LockTime))
+	buf = appendBytes(buf, out.Data)
+
+	return appendBytes(buf, out.ScriptHash)
+}
+
 /*
 A transaction is the first transaction (Coinbase) when:
   - The length of the inputs is 1
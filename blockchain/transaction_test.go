@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func testTransaction() *Transaction {
+	tx := &Transaction{
+		Inputs: []TxInput{{ID: []byte{1, 2, 3}, Out: 1, Sig: "alice", Sequence: 2, RedeemScript: testScript.Serialize()}},
+		Outputs: []TxOutput{
+			{Value: 40, PubKey: "bob", RelativeLock: 3},
+			{Value: 2, HashLock: []byte{4}, Refund: "alice", LockTime: 7, Data: []byte("memo")},
+		},
+	}
+	tx.SetID()
+
+	return tx
+}
+
+/*
+The ID of a transaction is referenced by the inputs spending it: it must never change, whatever the process encoded before
+*/
+func TestTransactionIDIsStable(t *testing.T) {
+	const (
+		serialized = "00000001" + //Inputs
+			"00000003010203" + "0000000000000001" + "00000005616c696365" + "0000000000000002" + //ID, Out, Sig, Sequence
+			"00000000" + "0000001100000005616c6963650000000000000003" + //Preimage, RedeemScript
+			"00000002" + //Outputs
+			"0000000000000028" + "00000003626f62" + "0000000000000003" + //Value, PubKey, RelativeLock
+			"00000000" + "00000000" + "0000000000000000" + "00000000" + "00000000" + //HashLock, Refund, LockTime, Data, ScriptHash
+			"0000000000000002" + "00000000" + "0000000000000000" +
+			"0000000104" + "00000005616c696365" + "0000000000000007" + "000000046d656d6f" + "00000000"
+		id = "0eb06b2efea59abff4dbb63e8b7f1d0678d461b64e406ebdc5d322ff996ca5e0"
+	)
+
+	tx := testTransaction()
+
+	if got := hex.EncodeToString(tx.Serialize()); got != serialized {
+		t.Fatalf("Serialize() = %s, want %s", got, serialized)
+	}
+
+	if got := hex.EncodeToString(tx.ID); got != id {
+		t.Fatalf("ID = %s, want %s", got, id)
+	}
+}
+
+func TestTransactionIDCoversEveryField(t *testing.T) {
+	id := testTransaction().ID
+
+	changes := []func(tx *Transaction){
+		func(tx *Transaction) { tx.Inputs[0].Out = 2 },
+		func(tx *Transaction) { tx.Inputs[0].Sequence = 0 },
+		func(tx *Transaction) { tx.Inputs[0].Preimage = []byte{1} },
+		func(tx *Transaction) { tx.Inputs[0].RedeemScript = nil },
+		func(tx *Transaction) { tx.Outputs[0].RelativeLock = 0 },
+		func(tx *Transaction) { tx.Outputs[1].LockTime = 8 },
+		func(tx *Transaction) { tx.Outputs[1].Data = nil },
+		func(tx *Transaction) { tx.Outputs[1].ScriptHash = []byte{5} },
+		//A field boundary can't be moved without changing the ID
+		func(tx *Transaction) { tx.Outputs[0].PubKey, tx.Outputs[1].Refund = "bo", "balice" },
+	}
+
+	for i, change := range changes {
+		tx := testTransaction()
+		change(tx)
+		tx.ID = nil
+		tx.SetID()
+
+		if bytes.Equal(tx.ID, id) {
+			t.Errorf("change %d doesn't change the ID", i)
+		}
+	}
+}
+
+func TestPaymentsTransaction(t *testing.T) {
+	chain := newTestChain(t)
+	funds := balance(chain, "alice")
+
+	payments := []Payment{
+		{Address: "bob", Amount: 300},
+		{Address: "carol", Amount: 200, RelativeLock: 5},
+		{Address: "bob", Amount: 100}, //An address can be paid more than once
+	}
+
+	tx, _ := NewPaymentsTransaction("alice", nil, payments, nil, chain)
+
+	//One output per payment in the same order, then the change
+	if len(tx.Outputs) != len(payments)+1 {
+		t.Fatalf("the transaction has %d outputs, want %d", len(tx.Outputs), len(payments)+1)
+	}
+	for i, payment := range payments {
+		out := tx.Outputs[i]
+		if out.PubKey != payment.Address || out.Value != payment.Amount || out.RelativeLock != payment.RelativeLock {
+			t.Errorf("output %d pays %s to %s locked for %d blocks, want %+v", i, out.Value, out.PubKey, out.RelativeLock, payment)
+		}
+	}
+	if change := tx.Outputs[len(payments)]; change.PubKey != "alice" || change.Value != funds-600 {
+		t.Errorf("the change pays %s to %s, want %s to alice", change.Value, change.PubKey, funds-600)
+	}
+
+	chain.AddBlock("miner", []*Transaction{tx})
+
+	for address, want := range map[string]Amount{"alice": funds - 600, "bob": 400, "carol": 200} {
+		if got := balance(chain, address); got != want {
+			t.Errorf("%s has %s, want %s", address, got, want)
+		}
+	}
+}
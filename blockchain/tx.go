@@ -1,14 +1,35 @@
 package blockchain
 
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/pierobassa/golang-blockchain/network"
+	"github.com/pierobassa/golang-blockchain/wallet"
+)
+
 type TxOutput struct {
-	Value  int    //Number of tokens
-	PubKey string //Used to unlock the tokens (in our case the account that made the transaction)
+	Value        Amount //Number of tokens (in the smallest unit)
+	PubKey       string //Used to unlock the tokens (in our case the account that made the transaction)
+	RelativeLock int    //Number of blocks that must be mined after the output's block before the output can be spent (0 means no lock)
+
+	//Hash time-locked contract (HTLC) fields. An output is an HTLC when HashLock is set
+	HashLock []byte //SHA256 hash of the secret that PubKey has to reveal to redeem the tokens
+	Refund   string //Account that can take the tokens back once the timeout is reached
+	LockTime int    //Block height from which Refund can spend the output. For the other outputs, height from which the output vests (can be spent at all)
+
+	Data []byte //Arbitrary data (up to MaxDataSize bytes). Data outputs hold no tokens, can't be spent and are never stored in the UTXO set
+
+	ScriptHash []byte //Hash of the redeem script for pay-to-script-hash outputs. The other lock fields are empty and the conditions come from the script
 }
 
 type TxInput struct {
-	ID  []byte //ID of the Transaction
-	Out int    //Position of the Output we are referring to (an Input references an Output)
-	Sig string //Used in the Output's PubKey (in our case it is the account that made the transaction)
+	ID           []byte //ID of the Transaction
+	Out          int    //Position of the Output we are referring to (an Input references an Output)
+	Sig          string //Used in the Output's PubKey (in our case it is the account that made the transaction)
+	Sequence     int    //Relative lock (in blocks) the input waits for, counted from the confirmation of the referenced Output
+	Preimage     []byte //Secret revealed when redeeming an HTLC output (empty otherwise)
+	RedeemScript []byte //Serialized redeem script revealed when spending a pay-to-script-hash output (empty otherwise)
 }
 
 /* --------------- UNLOCK Data inside the outputs and inputs of a transaction --------------- */
@@ -17,6 +38,97 @@ func (in *TxInput) CanUnlock(data string) bool {
 	return data == in.Sig //true if the data passed is equal to the signature of the input
 }
 
-func (out *TxOutput) CanBeUnlocked(data string) bool {
-	return data == out.PubKey //for the output it's the same but this time we are checking if the data is equal to the pub key of the output
+func (out *TxOutput) CanBeUnlocked(data string, params *network.ChainParams) bool {
+	if out.IsData() { //Nobody can unlock a data output
+		return false
+	}
+
+	if out.IsScriptHash() { //'data' must be the address of the script on the network of 'params'
+		scriptHash, ok := wallet.DecodeScriptHashAddress(data, params)
+
+		return ok && bytes.Equal(scriptHash, out.ScriptHash)
+	}
+
+	return out.IsHTLC() == false && data == out.PubKey //for the output it's the same but this time we are checking if the data is equal to the pub key of the output. HTLC outputs need more than the pub key
+}
+
+/*
+Checks every spend condition of the output (apart from the relative lock) against the input spending it in a block at 'spendHeight'.
+For pay-to-script-hash outputs 'out' must be the conditions of the redeem script (see Conditions)
+*/
+func (in *TxInput) CanSpend(out *TxOutput, spendHeight int) bool {
+	if out.IsHTLC() {
+		return out.CanRedeem(in) || out.CanRefund(in, spendHeight)
+	}
+
+	return in.CanUnlock(out.PubKey)
+}
+
+/* --------------- HASH TIME-LOCKED CONTRACTS --------------- */
+
+func (out *TxOutput) IsHTLC() bool {
+	return len(out.HashLock) > 0
+}
+
+/*
+Redeem path of an HTLC: the input is signed by the recipient and reveals the secret whose hash is the HashLock
+*/
+func (out *TxOutput) CanRedeem(in *TxInput) bool {
+	hash := sha256.Sum256(in.Preimage)
+
+	return in.CanUnlock(out.PubKey) && bytes.Equal(hash[:], out.HashLock)
+}
+
+/*
+Refund path of an HTLC: the input is signed by the sender and the block containing it is at least at LockTime
+*/
+func (out *TxOutput) CanRefund(in *TxInput, spendHeight int) bool {
+	return in.CanUnlock(out.Refund) && spendHeight >= out.LockTime
+}
+
+/* --------------- DATA OUTPUTS --------------- */
+
+// Maximum number of bytes a data output can carry
+const MaxDataSize = 80
+
+/*
+A data output is provably unspendable: it has no PubKey and nothing can unlock it
+*/
+func (out *TxOutput) IsData() bool {
+	return len(out.Data) > 0
+}
+
+/* --------------- RELATIVE LOCKS --------------- */
+
+/*
+An input's sequence is satisfied when at least 'Sequence' blocks have been mined since the referenced output was confirmed
+
+@param confHeight: height of the block that confirmed the referenced output
+@param spendHeight: height of the block that will contain the input
+*/
+func (in *TxInput) SequenceSatisfied(confHeight, spendHeight int) bool {
+	return spendHeight-confHeight >= in.Sequence
+}
+
+/*
+The output condition for relative locks: the spending input must commit to a sequence of at least RelativeLock blocks
+*/
+func (out *TxOutput) CheckSequence(sequence int) bool {
+	return sequence >= out.RelativeLock
+}
+
+/*
+Tells if the output can be spent by an input in a block at 'spendHeight' given that it was confirmed at 'confHeight'
+*/
+func (out *TxOutput) IsMature(confHeight, spendHeight int) bool {
+	return spendHeight-confHeight >= out.RelativeLock && out.IsVested(spendHeight)
+}
+
+/* --------------- VESTING --------------- */
+
+/*
+An output that isn't an HTLC and has a LockTime (ex: a premine allocation of the Genesis block) can't be spent in a block below LockTime
+*/
+func (out *TxOutput) IsVested(spendHeight int) bool {
+	return out.IsHTLC() || spendHeight >= out.LockTime
 }
@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+/*
+The transaction index is an optional index of the Badger DB that maps the ID of every transaction to the block that contains it.
+Without it finding a transaction means going through the whole blockchain.
+When enabled, the index is updated every time a block is connected to (or disconnected from) the blockchain.
+*/
+var (
+	txIndexPrefix = []byte("tx-")
+	txIndexKey    = []byte("txindex") //Present in the DB when the index is enabled
+)
+
+type TxIndex struct {
+	Blockchain *Blockchain
+}
+
+/*
+Where a transaction is stored:
+  - BlockHash: hash of the block that contains the transaction
+  - Position: index of the transaction in the block's transactions
+*/
+type TxLocation struct {
+	BlockHash []byte
+	Position  int
+}
+
+func (idx TxIndex) Enabled() bool {
+	_, err := idx.Blockchain.Database.Get(txIndexKey)
+	if err == ErrNotFound {
+		return false
+	}
+	Handle(err)
+
+	return true
+}
+
+/*
+Builds the index from the whole blockchain and enables it.
+The indexes are marked as out of sync until the rebuild is complete (see Blockchain.Repair)
+*/
+func (idx TxIndex) Reindex() {
+	idx.Blockchain.writeMu.Lock()
+	defer idx.Blockchain.writeMu.Unlock()
+
+	idx.reindex()
+}
+
+func (idx TxIndex) reindex() {
+	idx.Blockchain.markIndexesStale()
+
+	err := idx.Blockchain.Database.DeleteByPrefix(txIndexPrefix)
+	Handle(err)
+
+	iter := idx.Blockchain.Iterator()
+
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		err = idx.Blockchain.Database.Update(func(batch Batch) error {
+			idx.ConnectBlock(batch, block)
+			return nil
+		})
+		Handle(err)
+	}
+	Handle(iter.Err())
+
+	err = idx.Blockchain.Database.Update(func(batch Batch) error {
+		return batch.Set(txIndexKey, []byte{1})
+	})
+	Handle(err)
+
+	idx.Blockchain.markIndexesSynced()
+}
+
+/*
+Adds the transactions of a block as part of the batch that connects it to the blockchain
+*/
+func (idx TxIndex) ConnectBlock(batch Batch, block *Block) {
+	for position, tx := range block.Transactions {
+		location := TxLocation{block.Hash, position}
+
+		err := batch.Set(txIndexEntryKey(tx.ID), location.Serialize())
+		Handle(err)
+	}
+}
+
+/*
+Removes the transactions of a block as part of the batch that disconnects it from the blockchain
+*/
+func (idx TxIndex) DisconnectBlock(batch Batch, block *Block) {
+	for _, tx := range block.Transactions {
+		err := batch.Delete(txIndexEntryKey(tx.ID))
+		Handle(err)
+	}
+}
+
+/*
+@returns: the location of the transaction and false if it isn't in the index
+*/
+func (idx TxIndex) Find(ID []byte) (TxLocation, bool) {
+	v, err := idx.Blockchain.Database.Get(txIndexEntryKey(ID))
+	if err == ErrNotFound {
+		return TxLocation{}, false
+	}
+	Handle(err)
+
+	return DeserializeLocation(v), true
+}
+
+func txIndexEntryKey(txID []byte) []byte {
+	return append(append([]byte{}, txIndexPrefix...), txID...)
+}
+
+/* -------------- SERIALIZATION & DESERIALIZATION -------------- */
+
+func (l TxLocation) Serialize() []byte {
+	var buffer bytes.Buffer
+
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(l)
+	Handle(err)
+
+	return buffer.Bytes()
+}
+
+func DeserializeLocation(data []byte) TxLocation {
+	var location TxLocation
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&location)
+	Handle(err)
+
+	return location
+}
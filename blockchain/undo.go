@@ -0,0 +1,127 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+/*
+The undo data of a block lists the outputs it spent as they were in the UTXO set before the block was connected.
+Once a block is connected its spent outputs are gone from the UTXO set, so the undo data is what allows to disconnect it.
+It's written by UTXOSet.Update in the batch that connects the block and stored under the prefix followed by the hash of the block.
+*/
+var undoPrefix = []byte("undo-")
+
+/*
+Output spent by a block
+  - TxID, Index: the outpoint
+  - Output: the output itself (value, owner and locks)
+  - Height: height of the block that created the output
+  - Coinbase: true when the output was created by a coinbase transaction
+*/
+type SpentOutput struct {
+	TxID     []byte
+	Index    int
+	Output   TxOutput
+	Height   int
+	Coinbase bool
+}
+
+/*
+Outputs spent by a block, in the order the block spends them
+*/
+type BlockUndo struct {
+	Spent []SpentOutput
+}
+
+/*
+Retrieves the undo data of a block
+
+@returns: the undo data or an error if the block has none (ex: it was connected by an older version or it has been pruned)
+*/
+func (u UTXOSet) GetUndo(hash []byte) (*BlockUndo, error) {
+	return getUndo(u.Blockchain.Database.Get, hash)
+}
+
+func getUndo(get func(key []byte) ([]byte, error), hash []byte) (*BlockUndo, error) {
+	v, err := get(undoKey(hash))
+	if err == ErrNotFound {
+		return nil, fmt.Errorf("block %x has no undo data", hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	undo := DeserializeUndo(v)
+
+	return &undo, nil
+}
+
+/*
+Reverts UTXOSet.Update as part of the batch that disconnects the last block: the outputs created by the block are removed
+(the block is the last one, so none of them can be spent) and the outputs it spent are put back as they were
+
+@returns: an error if the block has no undo data
+*/
+func (u *UTXOSet) DisconnectBlock(batch Batch, block *Block) error {
+	undo, err := getUndo(batch.Get, block.Hash)
+	if err != nil {
+		return err
+	}
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		err = batch.Delete(utxoKey(block.Transactions[i].ID))
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(undo.Spent) - 1; i >= 0; i-- {
+		spent := undo.Spent[i]
+
+		outs := TxOutputs{make(map[int]TxOutput), spent.Height, spent.Coinbase}
+
+		v, err := batch.Get(utxoKey(spent.TxID))
+		if err == nil { //Other outputs of the transaction are still unspent
+			outs = DeserializeOutputs(v)
+		} else if err != ErrNotFound {
+			return err
+		}
+
+		outs.Outputs[spent.Index] = spent.Output
+
+		err = batch.Set(utxoKey(spent.TxID), outs.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return batch.Delete(undoKey(block.Hash))
+}
+
+func undoKey(hash []byte) []byte {
+	return append(append([]byte{}, undoPrefix...), hash...)
+}
+
+/* -------------- SERIALIZATION & DESERIALIZATION -------------- */
+
+func (undo BlockUndo) Serialize() []byte {
+	var buffer bytes.Buffer
+
+	encode := gob.NewEncoder(&buffer)
+	err := encode.Encode(undo)
+	Handle(err)
+
+	return buffer.Bytes()
+}
+
+func DeserializeUndo(data []byte) BlockUndo {
+	var undo BlockUndo
+
+	decode := gob.NewDecoder(bytes.NewReader(data))
+	err := decode.Decode(&undo)
+	Handle(err)
+
+	return undo
+}
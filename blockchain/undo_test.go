@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+/*
+Keys and values of the UTXO set, the indexes, the undo records and the last hash.
+The values written in a random order are decoded: the outputs of the UTXO set (a gob map) and the keys of a block in the address index
+*/
+func chainState(t *testing.T, chain *Blockchain) map[string]string {
+	t.Helper()
+
+	state := make(map[string]string)
+
+	for _, prefix := range [][]byte{utxoPrefix, heightIndexPrefix, txIndexPrefix, addrIndexPrefix, addrIndexBlockPrefix, undoPrefix, tipKey} {
+		err := chain.Database.Iterate(prefix, func(key, value []byte) error {
+			switch {
+			case bytes.HasPrefix(key, utxoPrefix):
+				value = []byte(fmt.Sprintf("%+v", DeserializeOutputs(value)))
+			case bytes.HasPrefix(key, addrIndexBlockPrefix):
+				keys := deserializeKeys(value)
+				sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+				value = bytes.Join(keys, nil)
+			}
+
+			state[string(key)] = string(value)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return state
+}
+
+func TestDisconnectBlockUndoesConnectBlock(t *testing.T) {
+	chain := newTestChain(t)
+
+	TxIndex{chain}.Reindex()
+	AddressIndex{chain}.Reindex()
+
+	before := chainState(t, chain)
+
+	reward := Amount(chain.Params.Reward(1))
+	block := chain.AddBlock("miner", []*Transaction{spendGenesis(t, chain, reward-10)})
+
+	connected := chainState(t, chain)
+	if _, found := connected[string(undoKey(block.Hash))]; !found {
+		t.Fatal("the block has no undo record")
+	}
+	if len(connected) <= len(before) {
+		t.Fatal("the block didn't add to the UTXO set and the indexes")
+	}
+
+	chain.writeMu.Lock()
+	err := chain.disconnectBlock(block)
+	chain.writeMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := chainState(t, chain)
+
+	for key, value := range before {
+		if got, found := after[key]; !found {
+			t.Errorf("%q is missing after the disconnection", key)
+		} else if got != value {
+			t.Errorf("%q = %x after the disconnection, want %x", key, got, value)
+		}
+	}
+
+	for key := range after {
+		if _, found := before[key]; !found {
+			t.Errorf("%q is left by the disconnected block", key)
+		}
+	}
+
+	if bytes.Equal(chain.LastHash(), block.PrevHash) == false {
+		t.Errorf("the last hash is %x, want the Genesis block %x", chain.LastHash(), block.PrevHash)
+	}
+}
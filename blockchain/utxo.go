@@ -0,0 +1,264 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+)
+
+/*
+The UTXO set is an index of the Unspent Transaction Outputs stored in the same Badger DB as the blocks.
+Every key is the prefix followed by the ID of the transaction that created the outputs.
+This way we don't need to go through the whole blockchain every time we need the balance of an address.
+*/
+var (
+	utxoPrefix   = []byte("utxo-")
+	prefixLength = len(utxoPrefix)
+)
+
+type UTXOSet struct {
+	Blockchain *Blockchain
+}
+
+/*
+Value stored in the UTXO set for a transaction
+  - Outputs: the unspent outputs of the transaction (output index -> output)
+  - Height: height of the block that confirmed the transaction. Needed to enforce relative locks
+  - Coinbase: true when the transaction is a coinbase transaction, whose outputs must wait for the coinbase maturity
+*/
+type TxOutputs struct {
+	Outputs  map[int]TxOutput
+	Height   int
+	Coinbase bool
+}
+
+/*
+Tells if the outputs can be spent in a block at 'spendHeight' as far as the coinbase maturity is concerned
+*/
+func (outs *TxOutputs) IsMature(spendHeight, coinbaseMaturity int) bool {
+	return outs.Coinbase == false || spendHeight-outs.Height >= coinbaseMaturity
+}
+
+/*
+Finds every output of 'address' that can be spent in the next block.
+Outputs whose relative lock hasn't expired yet and immature coinbase outputs are skipped.
+*/
+func (u UTXOSet) SpendableOutputs(address string) []SpendableOutput {
+	var spendable []SpendableOutput
+	spendHeight := u.Blockchain.GetBestHeight() + 1
+
+	err := u.Blockchain.Database.Iterate(utxoPrefix, func(key, v []byte) error {
+		txID := key[prefixLength:]
+		outs := DeserializeOutputs(v)
+
+		if outs.IsMature(spendHeight, u.Blockchain.Params.CoinbaseMaturity) == false {
+			return nil
+		}
+
+		for outIdx, out := range outs.Outputs {
+			if out.CanBeUnlocked(address, u.Blockchain.Params) && out.IsMature(outs.Height, spendHeight) {
+				spendable = append(spendable, SpendableOutput{txID, outIdx, out, outs.Height})
+			}
+		}
+
+		return nil
+	})
+	Handle(err)
+
+	return spendable
+}
+
+/*
+Picks the outputs of 'address' that pay for 'amount' tokens with the given coin selection strategy (LargestFirst when nil)
+
+@returns: the selected outputs or ErrInsufficientFunds
+*/
+func (u UTXOSet) FindSpendableOutputs(address string, amount Amount, selector CoinSelector) ([]SpendableOutput, error) {
+	if selector == nil {
+		selector = LargestFirst{}
+	}
+
+	return selector.Select(u.SpendableOutputs(address), amount)
+}
+
+/*
+Finds all the Unspent Transaction Outputs of a given address (locked ones included)
+*/
+func (u UTXOSet) FindUTXO(address string) []TxOutput {
+	var UTXOs []TxOutput
+
+	err := u.Blockchain.Database.Iterate(utxoPrefix, func(key, v []byte) error {
+		outs := DeserializeOutputs(v)
+
+		for _, out := range outs.Outputs {
+			if out.CanBeUnlocked(address, u.Blockchain.Params) {
+				UTXOs = append(UTXOs, out)
+			}
+		}
+
+		return nil
+	})
+	Handle(err)
+
+	return UTXOs
+}
+
+/*
+Retrieves a single unspent output
+
+@returns: the output, the unspent outputs of its transaction (with the height of the block that confirmed it) and false if the output doesn't exist or is already spent
+*/
+func (u UTXOSet) FindOutput(txID []byte, outIdx int) (TxOutput, TxOutputs, bool) {
+	return findOutput(u.Blockchain.Database.Get, txID, outIdx)
+}
+
+/*
+Retrieves a single unspent output with the given read function (of the store or of a batch)
+*/
+func findOutput(get func(key []byte) ([]byte, error), txID []byte, outIdx int) (TxOutput, TxOutputs, bool) {
+	v, err := get(utxoKey(txID))
+	if err == ErrNotFound {
+		return TxOutput{}, TxOutputs{}, false
+	}
+	Handle(err)
+
+	outs := DeserializeOutputs(v)
+	out, found := outs.Outputs[outIdx]
+
+	return out, outs, found
+}
+
+/*
+Counts the transactions with at least one unspent output
+*/
+func (u UTXOSet) CountTransactions() int {
+	counter := 0
+
+	err := u.Blockchain.Database.Iterate(utxoPrefix, func(key, value []byte) error {
+		counter++
+
+		return nil
+	})
+	Handle(err)
+
+	return counter
+}
+
+/*
+Deletes the UTXO set and builds it again by going through the whole blockchain.
+The indexes are marked as out of sync until the rebuild is complete (see Blockchain.Repair)
+*/
+func (u UTXOSet) Reindex() {
+	u.Blockchain.writeMu.Lock()
+	defer u.Blockchain.writeMu.Unlock()
+
+	u.reindex()
+}
+
+func (u UTXOSet) reindex() {
+	db := u.Blockchain.Database
+
+	u.Blockchain.markIndexesStale()
+
+	u.DeleteByPrefix(utxoPrefix)
+
+	UTXO := u.Blockchain.FindUTXO()
+
+	writer := chunkedWriter{store: db}
+	for txId, outs := range UTXO {
+		txID, err := hex.DecodeString(txId)
+		Handle(err)
+
+		err = writer.Set(utxoKey(txID), outs.Serialize())
+		Handle(err)
+	}
+
+	err := writer.Flush()
+	Handle(err)
+
+	u.Blockchain.markIndexesSynced()
+}
+
+/*
+Updates the UTXO set with the transactions of a new block as part of the batch that connects it:
+the outputs referenced by the inputs are removed and the new outputs are added with the height of the block.
+The removed outputs are written as the undo data of the block (see UTXOSet.DisconnectBlock)
+*/
+func (u *UTXOSet) Update(batch Batch, block *Block) {
+	var undo BlockUndo
+
+	for _, tx := range block.Transactions {
+		if tx.isCoinbase() == false {
+			for _, in := range tx.Inputs {
+				inID := utxoKey(in.ID)
+
+				v, err := batch.Get(inID)
+				Handle(err)
+
+				outs := DeserializeOutputs(v)
+				undo.Spent = append(undo.Spent, SpentOutput{in.ID, in.Out, outs.Outputs[in.Out], outs.Height, outs.Coinbase})
+				delete(outs.Outputs, in.Out)
+
+				if len(outs.Outputs) == 0 { //Every output of the transaction has been spent
+					err = batch.Delete(inID)
+				} else {
+					err = batch.Set(inID, outs.Serialize())
+				}
+				Handle(err)
+			}
+		}
+
+		newOutputs := TxOutputs{make(map[int]TxOutput), block.Height, tx.isCoinbase()}
+		for outIdx, out := range tx.Outputs {
+			if out.IsData() { //Data outputs can't be spent so they never enter the UTXO set
+				continue
+			}
+			newOutputs.Outputs[outIdx] = out
+		}
+
+		if len(newOutputs.Outputs) > 0 {
+			err := batch.Set(utxoKey(tx.ID), newOutputs.Serialize())
+			Handle(err)
+		}
+	}
+
+	err := batch.Set(undoKey(block.Hash), undo.Serialize())
+	Handle(err)
+}
+
+/*
+Deletes every key that starts with 'prefix'
+*/
+func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
+	err := u.Blockchain.Database.DeleteByPrefix(prefix)
+	Handle(err)
+}
+
+/*
+Key of a transaction in the UTXO set: the prefix followed by the transaction ID
+*/
+func utxoKey(txID []byte) []byte {
+	return append(append([]byte{}, utxoPrefix...), txID...) //copying the prefix so the keys never share the same underlying array
+}
+
+/* -------------- SERIALIZATION & DESERIALIZATION -------------- */
+
+func (outs TxOutputs) Serialize() []byte {
+	var buffer bytes.Buffer
+
+	encode := gob.NewEncoder(&buffer)
+	err := encode.Encode(outs)
+	Handle(err)
+
+	return buffer.Bytes()
+}
+
+func DeserializeOutputs(data []byte) TxOutputs {
+	var outputs TxOutputs
+
+	decode := gob.NewDecoder(bytes.NewReader(data))
+	err := decode.Decode(&outputs)
+	Handle(err)
+
+	return outputs
+}
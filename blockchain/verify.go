@@ -0,0 +1,317 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+/*
+Levels of VerifyChain. Every level also runs the checks of the levels below it:
+  - VerifyBlocks: proof of work, hash of the block (which covers the hash of its transactions), height, link to the previous block, timestamp and checkpoints
+  - VerifyTxIDs: the ID of every transaction matches its content
+  - VerifyTransactions: the rules of ValidateTransactions (inputs unlocking their outputs, reward schedule, locks, ...) against the UTXO set replayed up to the block.
+    Like for an import, the inputs of the blocks up to the assumed-valid block aren't checked against the outputs they unlock
+  - VerifyUTXO: the UTXO set replayed up to the last block matches the stored one
+*/
+const (
+	VerifyBlocks = iota
+	VerifyTxIDs
+	VerifyTransactions
+	VerifyUTXO
+)
+
+/*
+Result of VerifyChain
+  - From, To: heights of the first and of the last checked block
+  - Blocks: number of checked blocks
+  - UTXOs: number of transactions of the UTXO set that have been compared (VerifyUTXO only)
+  - Problem: the first inconsistency found, nil if the blockchain is consistent
+*/
+type VerifyReport struct {
+	Level   int
+	From    int
+	To      int
+	Blocks  int
+	UTXOs   int
+	Problem error
+}
+
+/*
+Checks the last 'depth' blocks (every block when 'depth' is 0) at the given level and stops at the first inconsistency.
+From VerifyTransactions the UTXO set is replayed in memory from the Genesis block, so the older blocks are read (but not checked) too.
+Blocks can't be added while the blockchain is verified
+
+@returns: the report or an error if the blocks needed by the checks have been pruned
+*/
+func (chain *Blockchain) VerifyChain(depth int, level int) (*VerifyReport, error) {
+	chain.writeMu.Lock()
+	defer chain.writeMu.Unlock()
+
+	lastHash := chain.LastHash()
+	bestHeight := chain.GetBestHeight()
+
+	report := &VerifyReport{Level: level, From: 0, To: bestHeight}
+	if depth > 0 && depth <= bestHeight {
+		report.From = bestHeight - depth + 1
+	}
+
+	start := report.From
+	if level >= VerifyTransactions {
+		start = 0
+	}
+
+	if prunedHeight, found := chain.PrunedHeight(); found && start <= prunedHeight {
+		if level >= VerifyTransactions {
+			return nil, fmt.Errorf("level %d replays every block, but the blocks up to height %d have been pruned", level, prunedHeight)
+		}
+
+		return nil, fmt.Errorf("the blocks up to height %d have been pruned, the depth can be at most %d", prunedHeight, bestHeight-prunedHeight)
+	}
+
+	var prevHash []byte
+	if start > 0 {
+		heightIndex := HeightIndex{chain}
+
+		hash, err := heightIndex.GetHash(start - 1)
+		if err != nil {
+			report.Problem = fmt.Errorf("block %d: %v", start-1, err)
+			return report, nil
+		}
+		prevHash = hash
+	}
+
+	replay := NewMemoryStore() //UTXO set rebuilt block by block
+	findReplayed := func(txID []byte, outIdx int) (TxOutput, TxOutputs, bool) {
+		return findOutput(replay.Get, txID, outIdx)
+	}
+
+	for height := start; height <= bestHeight; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			report.Problem = fmt.Errorf("block %d: %v", height, err)
+			return report, nil
+		}
+
+		if height >= report.From {
+			err = chain.verifyBlock(block, height, prevHash, level, findReplayed)
+			if err != nil {
+				report.Problem = fmt.Errorf("block %d (%x): %v", height, block.Hash, err)
+				return report, nil
+			}
+			report.Blocks++
+		}
+
+		if level >= VerifyTransactions {
+			err = replayBlock(replay, block)
+			if err != nil {
+				report.Problem = fmt.Errorf("block %d (%x): %v", height, block.Hash, err)
+				return report, nil
+			}
+		}
+
+		prevHash = block.Hash
+	}
+
+	if bytes.Equal(prevHash, lastHash) == false {
+		report.Problem = fmt.Errorf("the block at height %d (%x) is not the last block (%x)", bestHeight, prevHash, lastHash)
+		return report, nil
+	}
+
+	if level >= VerifyUTXO {
+		report.UTXOs, report.Problem = chain.compareUTXO(replay)
+	}
+
+	return report, nil
+}
+
+func (chain *Blockchain) verifyBlock(block *Block, height int, prevHash []byte, level int, findOutput func(txID []byte, outIdx int) (TxOutput, TxOutputs, bool)) error {
+	if block.Height != height {
+		return fmt.Errorf("the block has height %d instead of %d", block.Height, height)
+	}
+
+	if bytes.Equal(block.PrevHash, prevHash) == false {
+		return fmt.Errorf("the previous hash is %x instead of %x", block.PrevHash, prevHash)
+	}
+
+	if len(block.Transactions) == 0 {
+		return errors.New("the block has no transactions")
+	}
+
+	if err := chain.checkTimestamp(block); err != nil {
+		return err
+	}
+
+	pow := NewProof(block, chain.Params.Difficulty)
+
+	hash := sha256.Sum256(pow.InitData(block.Nonce))
+	if bytes.Equal(hash[:], block.Hash) == false {
+		return errors.New("the hash doesn't match the content of the block")
+	}
+
+	if pow.Validate() == false {
+		return errors.New("the hash doesn't meet the difficulty")
+	}
+
+	if err := chain.checkCheckpoint(block); err != nil {
+		return err
+	}
+
+	if level < VerifyTxIDs {
+		return nil
+	}
+
+	for _, tx := range block.Transactions {
+		txCopy := *tx
+		txCopy.ID = nil
+		txCopy.SetID()
+
+		if bytes.Equal(txCopy.ID, tx.ID) == false {
+			return fmt.Errorf("transaction %x: the ID doesn't match the content of the transaction", tx.ID)
+		}
+	}
+
+	if level < VerifyTransactions {
+		return nil
+	}
+
+	if height == 0 { //The Genesis block follows the network or the genesis spec (ex: a premine), not the reward schedule
+		for _, tx := range block.Transactions {
+			if tx.isCoinbase() == false {
+				return fmt.Errorf("transaction %x: the Genesis block can only contain coinbase transactions", tx.ID)
+			}
+		}
+
+		return nil
+	}
+
+	return chain.validateTransactions(block.Transactions, height, chain.assumedValid(block) == false, findOutput)
+}
+
+// How far ahead of the local clock the timestamp of a block can be
+const MaxFutureBlockTime = 2 * time.Hour
+
+/*
+The timestamp of a block can't be earlier than the one of its parent (the time a notarized document was included can be trusted)
+or later than the local clock plus MaxFutureBlockTime.
+The parent of the block of a UTXO snapshot isn't stored yet: its timestamp is checked by ValidateSnapshot
+
+@returns: an error if the timestamp is out of these bounds
+*/
+func (chain *Blockchain) checkTimestamp(block *Block) error {
+	if limit := time.Now().Add(MaxFutureBlockTime).Unix(); block.Timestamp > limit {
+		return fmt.Errorf("the timestamp %d is more than %s in the future", block.Timestamp, MaxFutureBlockTime)
+	}
+
+	if len(block.PrevHash) == 0 {
+		return nil
+	}
+
+	parent, err := getHeader(chain.Database.Get, block.PrevHash)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if block.Timestamp < parent.Timestamp {
+		return fmt.Errorf("the timestamp %d is earlier than the one of the previous block (%d)", block.Timestamp, parent.Timestamp)
+	}
+
+	return nil
+}
+
+/*
+Applies a block to the replayed UTXO set. Blocks below the checked depth aren't validated,
+so the spent outputs are checked here to report a missing output instead of failing in UTXOSet.Update
+*/
+func replayBlock(replay *MemoryStore, block *Block) error {
+	spent := make(map[string]bool)
+
+	for _, tx := range block.Transactions {
+		if tx.isCoinbase() {
+			continue
+		}
+
+		for _, in := range tx.Inputs {
+			outpoint := formatOutpoint(in.ID, in.Out)
+
+			_, _, found := findOutput(replay.Get, in.ID, in.Out)
+			if !found || spent[outpoint] {
+				return fmt.Errorf("transaction %x: output %s does not exist or is already spent", tx.ID, outpoint)
+			}
+			spent[outpoint] = true
+		}
+	}
+
+	return replay.Update(func(batch Batch) error {
+		UTXOSet := UTXOSet{}
+		UTXOSet.Update(batch, block)
+
+		return nil
+	})
+}
+
+/*
+Compares the replayed UTXO set with the stored one, in key order
+
+@returns: the number of compared transactions and the first difference
+*/
+func (chain *Blockchain) compareUTXO(replay *MemoryStore) (int, error) {
+	type entry struct {
+		key   []byte
+		value []byte
+	}
+
+	collect := func(store Store) ([]entry, error) {
+		var entries []entry
+
+		err := store.Iterate(utxoPrefix, func(key, value []byte) error {
+			entries = append(entries, entry{key, value})
+			return nil
+		})
+
+		return entries, err
+	}
+
+	expected, err := collect(replay)
+	Handle(err)
+
+	stored, err := collect(chain.Database)
+	if err != nil {
+		return 0, fmt.Errorf("UTXO set: %v", err)
+	}
+
+	i, j := 0, 0
+	for i < len(expected) || j < len(stored) {
+		var order int
+		switch {
+		case i == len(expected):
+			order = 1
+		case j == len(stored):
+			order = -1
+		default:
+			order = bytes.Compare(expected[i].key, stored[j].key)
+		}
+
+		switch order {
+		case -1:
+			return i, fmt.Errorf("UTXO set: transaction %x has unspent outputs but is missing", expected[i].key[prefixLength:])
+		case 1:
+			return i, fmt.Errorf("UTXO set: transaction %x is stored but has no unspent outputs", stored[j].key[prefixLength:])
+		}
+
+		if reflect.DeepEqual(DeserializeOutputs(expected[i].value), DeserializeOutputs(stored[j].value)) == false {
+			return i, fmt.Errorf("UTXO set: the outputs of transaction %x don't match the blocks", expected[i].key[prefixLength:])
+		}
+
+		i++
+		j++
+	}
+
+	return len(expected), nil
+}
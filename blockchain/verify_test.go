@@ -0,0 +1,31 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyBlockTimestamp(t *testing.T) {
+	chain := newTestChain(t)
+	parent := chain.AddBlock("miner", nil)
+
+	block := func(timestamp int64) *Block {
+		coinbase := CoinbaseTx("miner", "block 2", Amount(chain.Params.Reward(2)))
+		return mineBlock([]*Transaction{coinbase}, parent.Hash, 2, timestamp, chain.Params.Difficulty)
+	}
+
+	invalid := map[string]int64{
+		"earlier than the parent": parent.Timestamp - 1,
+		"too far in the future":   time.Now().Add(MaxFutureBlockTime + time.Minute).Unix(),
+	}
+
+	for name, timestamp := range invalid {
+		if err := chain.ImportBlock(block(timestamp)); err == nil {
+			t.Errorf("a block with a timestamp %s was accepted", name)
+		}
+	}
+
+	if err := chain.ImportBlock(block(parent.Timestamp)); err != nil {
+		t.Fatalf("a block with the timestamp of its parent was refused: %v", err)
+	}
+}
@@ -1,36 +1,126 @@
 package cli
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/dgraph-io/badger"
 	"github.com/pierobassa/golang-blockchain/wallet"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/pierobassa/golang-blockchain/blockchain"
+	"github.com/pierobassa/golang-blockchain/network"
 )
 
 /*
 CommandLine is a struct to facilitate interacting with the blockchain
 */
 type CommandLine struct {
+	params     *network.ChainParams //Parameters of the network selected with the global options
+	pruneDepth int                  //Prune depth of the -prune global option (0 keeps every block)
 }
 
 func (cli *CommandLine) printUsage() {
-	fmt.Println("Usage:")
+	fmt.Println("Usage: [-datadir DIR] [-network main|test|regtest] [-prune BLOCKS] COMMAND")
+	fmt.Println(" -datadir DIR -> directory of the blockchain and the wallets (default ./tmp, or $BLOCKCHAIN_DATADIR)")
+	fmt.Println(" -network NAME -> network to use (default main, or $BLOCKCHAIN_NETWORK). test and regtest are stored in their own subdirectory")
+	fmt.Printf(" -prune BLOCKS -> deletes the transactions of the blocks with more than BLOCKS blocks on top of them (at least %d). The commands that need them fail afterwards\n", blockchain.MinPruneDepth)
 	fmt.Println(" getbalance -address ADDRESS -> get the balance of the ADDRESS")
-	fmt.Println(" createblockchain -address ADDRESS -> creates a blockchain")
+	fmt.Println(" createblockchain -address ADDRESS [-txindex] [-addrindex] -> creates a blockchain. With -txindex, transactions are indexed by ID. With -addrindex, the history of every address is indexed")
+	fmt.Println(" createblockchain -genesis FILE [-txindex] [-addrindex] -> creates a blockchain with the Genesis block described by the JSON spec FILE (timestamp, message and allocations)")
 	fmt.Println(" printchain -> prints the blocks in the chain")
-	fmt.Println(" send -from FROM -to TO -amount AMOUNT -> sends AMOUNT from FROM to TO")
+	fmt.Println(" exportchain -out FILE -> writes the blocks of the chain to the bootstrap FILE")
+	fmt.Println(" importchain -in FILE -> validates and connects the blocks of the bootstrap FILE (creates the blockchain if needed). Run it again to resume an interrupted import")
+	fmt.Println(" dumputxo -out FILE [-height HEIGHT] -> writes the UTXO set at HEIGHT (the last block by default) to the snapshot FILE and prints its hash")
+	fmt.Println(" loadutxo -in FILE [-hash HASH] [-blocks FILE] -> creates the blockchain from the UTXO snapshot FILE if its hash is the one configured for its height (or HASH when none is configured). With -blocks, the blocks below the snapshot are validated from a bootstrap file in the background of the next commands")
+	fmt.Println(" validatesnapshot -blocks FILE -> validates the blocks below the snapshot the blockchain was loaded from with a bootstrap file, resuming the validation done in the background")
+	fmt.Println(" verifychain [-depth BLOCKS] [-level 0-3] -> checks the last BLOCKS blocks (all by default) and prints the first inconsistency found. Levels: 0 proof of work and links, 1 transaction IDs, 2 transaction rules and rewards, 3 UTXO set (default)")
+	fmt.Println(" invalidateblock -hash HASH -> marks the block HASH and its descendants invalid and rewinds the chain to its parent, or to the longest valid branch stored. The transactions of the disconnected blocks must be sent again")
+	fmt.Println(" reconsiderblock -hash HASH -> clears the invalid mark of the block HASH (and of its ancestors and descendants) and switches to their branch if it's longer than the chain")
+	fmt.Println(" send -from FROM -to TO -amount AMOUNT [-lock BLOCKS] [-redeemscript SCRIPT] -> sends AMOUNT from FROM to TO. With -lock, TO can spend it only BLOCKS blocks after it is confirmed. SCRIPT is needed when FROM is a pay-to-script-hash address")
+	fmt.Println(" send -from FROM -to TO:AMOUNT [-to TO:AMOUNT ...] [-csv FILE] -> sends to many recipients in a single transaction. FILE has one 'address,amount' record per line")
+	fmt.Println("      [-strategy largest|smallest|bnb|random] -> coin selection strategy of send (default largest)")
+	fmt.Println(" createscript -pubkey PUBKEY [-lock BLOCKS] -> creates a pay-to-script-hash address that PUBKEY can spend (BLOCKS blocks after confirmation with -lock)")
 	fmt.Println(" createwalllet -> creates a new Wallet")
 	fmt.Println(" listaddresses -> Lists all of the addresses of wallets stored")
+	fmt.Println(" migratedb [-dryrun] [-backup FILE] -> upgrades the database to the schema version of this program. Destructive steps are preceded by a backup to FILE (blocks-vVERSION-TIME.bak in the data directory by default). With -dryrun, only lists the pending steps")
+	fmt.Println(" reindexutxo -> Rebuilds the UTXO set")
+	fmt.Println(" reindextx -> Builds (and enables) the transaction index")
+	fmt.Println(" gettx -id TXID -> prints the transaction TXID, its block and its confirmations")
+	fmt.Println(" getblockcount -> prints the number of blocks in the chain")
+	fmt.Println(" getblockhash -height HEIGHT -> prints the hash of the block at HEIGHT")
+	fmt.Println(" getblock -hash HASH | -height HEIGHT -> prints a block and its transactions")
+	fmt.Println(" reindexaddr -> Builds (and enables) the address index")
+	fmt.Println(" history -address ADDRESS [-page N] [-pagesize SIZE] -> prints the transactions of ADDRESS with the running balance")
+	fmt.Println(" notarize -from FROM -file PATH -> writes the hash of the file PATH in the blockchain (FROM pays for the transaction)")
+	fmt.Println(" verifynotary -file PATH -> prints the block and the time in which the hash of the file PATH was written")
+	fmt.Println(" initiate -from FROM -to TO -amount AMOUNT [-timeout BLOCKS] -> starts an atomic swap locking AMOUNT for TO with a new secret")
+	fmt.Println(" participate -from FROM -to TO -amount AMOUNT -hash HASH [-timeout BLOCKS] -> joins an atomic swap locking AMOUNT for TO with the secret hash of the initiator")
+	fmt.Println(" redeem -contract TXID -secret SECRET -> redeems the contract TXID revealing SECRET")
+	fmt.Println(" refund -contract TXID -> gives the tokens of the contract TXID back to its sender after the timeout")
+	fmt.Println(" extractsecret -tx TXID -hash HASH -> prints the secret of HASH revealed by the redeem transaction TXID")
 }
 
-func (cli *CommandLine) validateArgs() {
-	if len(os.Args) < 2 {
+/*
+Parses the options that come before the command and selects the network and the data directory
+
+@returns: the command and its arguments
+*/
+func (cli *CommandLine) parseGlobalOptions() []string {
+	globalCmd := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	globalCmd.Usage = cli.printUsage
+
+	dataDir := globalCmd.String("datadir", "", "Directory of the blockchain and the wallets")
+	networkName := globalCmd.String("network", "", "Network to use: main, test or regtest")
+	pruneDepth := globalCmd.Int("prune", 0, "Number of blocks whose transactions are kept (0 keeps every block)")
+
+	err := globalCmd.Parse(os.Args[1:]) //Stops at the command
+	if err != nil {
+		log.Panic(err)
+	}
+
+	cli.params, err = network.Select(*networkName, *dataDir)
+	if err != nil {
+		fmt.Println(err)
+		runtime.Goexit()
+	}
+
+	if *pruneDepth != 0 && *pruneDepth < blockchain.MinPruneDepth {
+		fmt.Printf("The prune depth must be at least %d blocks\n", blockchain.MinPruneDepth)
+		runtime.Goexit()
+	}
+	cli.pruneDepth = *pruneDepth
+
+	return globalCmd.Args()
+}
+
+/*
+Opens the blockchain of the selected network, pruned to the depth of the -prune option
+*/
+func (cli *CommandLine) openChain() *blockchain.Blockchain {
+	chain := blockchain.ContinueBlockchain("", cli.params)
+	cli.enablePruning(chain)
+
+	return chain
+}
+
+func (cli *CommandLine) enablePruning(chain *blockchain.Blockchain) {
+	if _, err := chain.SetPruneDepth(cli.pruneDepth); err != nil {
+		fmt.Println(err)
+		chain.Close()
+		runtime.Goexit()
+	}
+}
+
+func (cli *CommandLine) validateArgs(args []string) {
+	if len(args) < 1 {
 		cli.printUsage()
 
 		runtime.Goexit() //Exits the application but, unlike os.Exit, it exits the application by shutting down the Go routine
@@ -41,143 +131,1161 @@ func (cli *CommandLine) validateArgs() {
 	}
 }
 
-func (cli *CommandLine) listAddresses() {
-	wallets, _ := wallet.CreateWallets()
-	addresses := wallets.GetAllAddresses()
+/*
+Exits if one of the addresses belongs to another network than the selected one (see wallet.CheckNetwork)
+*/
+func (cli *CommandLine) checkNetwork(addresses ...string) {
+	for _, address := range addresses {
+		if err := wallet.CheckNetwork(address, cli.params); err != nil {
+			fmt.Println(err)
+			runtime.Goexit()
+		}
+	}
+}
+
+func (cli *CommandLine) listAddresses() {
+	wallets, _ := wallet.CreateWallets(cli.params)
+	addresses := wallets.GetAllAddresses()
+
+	for _, address := range addresses {
+		fmt.Println(address)
+	}
+}
+
+func (cli *CommandLine) createWallet() {
+	wallets, _ := wallet.CreateWallets(cli.params)
+	address := wallets.AddWallet()
+
+	wallets.SaveFile()
+
+	fmt.Printf("New address is: %s\n", address)
+}
+
+func (cli *CommandLine) printChain() {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	iter := chain.Iterator()
+
+	for block := iter.Next(); block != nil; block = iter.Next() {
+		fmt.Println()
+		fmt.Printf("Previous Hash: %x\n", block.PrevHash)
+		fmt.Printf("Hash: %x\n", block.Hash)
+
+		pow := blockchain.NewProof(block, chain.Params.Difficulty)
+		fmt.Printf("PoW: %s\n", strconv.FormatBool(pow.Validate())) //Proof of work is done on each block, it doesn't store the blocks. Blockchain does
+		fmt.Println()
+	}
+
+	if iter.Err() != nil {
+		fmt.Printf("Stopped: %v\n", iter.Err())
+	}
+}
+
+func (cli *CommandLine) verifyChain(depth int, level int) {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	report, err := chain.VerifyChain(depth, level)
+	if err != nil {
+		fmt.Printf("Can't verify the blockchain: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Verified %d blocks (heights %d to %d) at level %d\n", report.Blocks, report.From, report.To, report.Level)
+	if report.Level >= blockchain.VerifyUTXO && report.Problem == nil {
+		fmt.Printf("UTXO set: %d transactions match the blocks\n", report.UTXOs)
+	}
+
+	if report.Problem != nil {
+		fmt.Printf("Inconsistency found: %v\n", report.Problem)
+		return
+	}
+
+	fmt.Println("No inconsistency found")
+}
+
+func (cli *CommandLine) invalidateBlock(hash string) {
+	blockHash, err := hex.DecodeString(hash)
+	if err != nil {
+		fmt.Printf("Invalid block hash: %v\n", err)
+		return
+	}
+
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	disconnected, connected, err := chain.InvalidateBlock(blockHash)
+	if err != nil && disconnected == 0 {
+		fmt.Printf("Can't invalidate the block: %v\n", err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("The rewind stopped after %d blocks disconnected and %d connected, run invalidateblock again to resume it: %v\n", disconnected, connected, err)
+		return
+	}
+
+	fmt.Printf("Block %x marked invalid, %d blocks disconnected\n", blockHash, disconnected)
+	if connected > 0 {
+		fmt.Printf("Switched to a longer stored branch: %d blocks connected\n", connected)
+	}
+	fmt.Printf("Last block: %x (height %d)\n", chain.LastHash(), chain.GetBestHeight())
+}
+
+func (cli *CommandLine) reconsiderBlock(hash string) {
+	blockHash, err := hex.DecodeString(hash)
+	if err != nil {
+		fmt.Printf("Invalid block hash: %v\n", err)
+		return
+	}
+
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	cleared, reconnected, err := chain.ReconsiderBlock(blockHash)
+	if err != nil && cleared == 0 {
+		fmt.Printf("Can't reconsider the block: %v\n", err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Cleared %d marks, %d blocks reconnected: %v\n", cleared, reconnected, err)
+		return
+	}
+
+	fmt.Printf("Cleared %d marks, %d blocks reconnected\n", cleared, reconnected)
+	if reconnected < cleared {
+		fmt.Println("The other blocks aren't part of a branch longer than the chain and stay out of it")
+	}
+	fmt.Printf("Last block: %x (height %d)\n", chain.LastHash(), chain.GetBestHeight())
+}
+
+func (cli *CommandLine) migrateDB(dryRun bool, backup string) {
+	if blockchain.DBExists(cli.params) == false {
+		fmt.Println("No existing blockchain found, create one!")
+		return
+	}
+
+	store, err := blockchain.OpenBadgerStore(network.BlocksDir(cli.params))
+	blockchain.Handle(err)
+
+	defer func(Database blockchain.Store) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := Database.Close()
+		blockchain.Handle(err)
+	}(store)
+
+	version, err := blockchain.GetSchemaVersion(store)
+	blockchain.Handle(err)
+
+	if backup == "" {
+		//Timestamped, so an upgrade that failed after its backup can be run again
+		backup = filepath.Join(network.Dir(cli.params), fmt.Sprintf("blocks-v%d-%s.bak", version, time.Now().Format("20060102-150405")))
+	}
+
+	fmt.Printf("Schema version: %d (this program uses version %d)\n", version, blockchain.SchemaVersion)
+
+	migrations, err := blockchain.Migrate(store, cli.params, backup, dryRun, func(migration blockchain.Migration) {
+		fmt.Printf("Migrating to version %d: %s\n", migration.Version, migration.Description)
+	})
+
+	if dryRun && err == nil {
+		for _, migration := range migrations {
+			fmt.Printf("Pending migration to version %d: %s\n", migration.Version, migration.Description)
+			if migration.Destructive {
+				fmt.Printf("   destructive, the database is backed up to %s first\n", backup)
+			}
+		}
+	}
+
+	if err != nil {
+		fmt.Printf("Migration stopped after %d steps: %v\n", len(migrations), err)
+		return
+	}
+
+	if len(migrations) == 0 {
+		fmt.Println("The database is up to date")
+	} else if dryRun == false {
+		fmt.Printf("Done! The database has version %d\n", blockchain.SchemaVersion)
+	}
+}
+
+func (cli *CommandLine) exportChain(out string) {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	file, err := os.Create(out)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+
+	written, err := chain.Export(file, printProgress("Exported"))
+	if err != nil {
+		fmt.Printf("Export failed after %d blocks: %v\n", written, err)
+		return
+	}
+
+	fmt.Printf("Done! %d blocks written to %s\n", written, out)
+}
+
+/*
+@returns: a reader of the bootstrap file positioned at its Genesis block again
+*/
+func rereadBootstrap(file *os.File) (*blockchain.BootstrapReader, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return blockchain.NewBootstrapReader(file)
+}
+
+func (cli *CommandLine) importChain(in string) {
+	file, err := os.Open(in)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+
+	reader, err := blockchain.NewBootstrapReader(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if reader.Network != cli.params.Name {
+		fmt.Printf("The bootstrap file is for the %s network, not %s\n", reader.Network, cli.params.Name)
+		return
+	}
+
+	var chain *blockchain.Blockchain
+
+	if blockchain.DBExists(cli.params) {
+		chain = cli.openChain()
+		fmt.Printf("Resuming the import after height %d\n", chain.GetBestHeight())
+	} else {
+		genesis, err := reader.Next()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		err = blockchain.ValidateGenesis(genesis, cli.params)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		chain = blockchain.InitBlockchainWithGenesis(genesis, cli.params)
+		cli.enablePruning(chain)
+	}
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	//A first pass finds the assumed-valid block and its ancestors, the second one imports the blocks from the Genesis block
+	reader, err = rereadBootstrap(file)
+	if err == nil {
+		var assumed int
+		assumed, err = chain.FindAssumeValid(reader)
+		if assumed > 0 {
+			fmt.Printf("Found the assumed-valid block: the inputs of the %d blocks up to it aren't checked against the outputs they unlock\n", assumed)
+		}
+	}
+	if err == nil {
+		reader, err = rereadBootstrap(file)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	imported, err := chain.Import(reader, func(height, total int) {
+		printProgress("Imported")(height+1, total) //The Genesis block has height 0
+	})
+	if err != nil {
+		fmt.Printf("Import stopped after %d new blocks: %v\n", imported, err)
+		fmt.Println("The blockchain ends at the last valid block, fix the file and run importchain again to resume")
+		return
+	}
+
+	fmt.Printf("Done! %d new blocks imported, the last block has height %d\n", imported, chain.GetBestHeight())
+}
+
+func (cli *CommandLine) dumpUTXO(out string, height int) {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	if height == -1 {
+		height = chain.GetBestHeight()
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+
+	hash, count, err := chain.DumpUTXO(file, height)
+	if err != nil {
+		fmt.Printf("Dump failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Done! %d transactions of the UTXO set at height %d written to %s\n", count, height, out)
+	fmt.Printf("Snapshot hash: %x\n", hash)
+}
+
+func (cli *CommandLine) loadUTXO(in string, trustedHash string, blocksFile string) {
+	file, err := os.Open(in)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+
+	snapshot, err := blockchain.ReadUTXOSnapshot(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = snapshot.CheckHash(cli.params, trustedHash)
+	if err != nil {
+		fmt.Printf("Snapshot refused: %v\n", err)
+		return
+	}
+
+	chain := blockchain.InitBlockchainFromSnapshot(snapshot, cli.params)
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	fmt.Printf("The blockchain starts at height %d (block %x) with %d transactions in the UTXO set\n", snapshot.Height, snapshot.Block.Hash, snapshot.Transactions())
+
+	if blocksFile == "" {
+		fmt.Println("The blocks below the snapshot aren't validated yet, run validatesnapshot with a bootstrap file")
+		return
+	}
+
+	err = chain.SetSnapshotBlocks(blocksFile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("The blocks below the snapshot are validated in the background of the next commands, validatesnapshot waits for them")
+}
+
+func (cli *CommandLine) validateSnapshot(blocksFile string) {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	height, found := chain.SnapshotHeight()
+	if !found {
+		fmt.Println("Every block of the blockchain is already validated")
+		return
+	}
+
+	chain.StopSnapshotValidation() //The blocks it validated are skipped
+
+	file, err := os.Open(blocksFile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+
+	reader, err := blockchain.NewBootstrapReader(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	//Recorded first, so an interrupted validation is resumed in the background by the next commands
+	err = chain.SetSnapshotBlocks(blocksFile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Validating the blocks below height %d...\n", height)
+
+	err = chain.ValidateSnapshot(reader, func(height, total int) {
+		printProgress("Validated")(height+1, total+1) //The Genesis block has height 0
+	})
+	if err != nil {
+		fmt.Printf("Snapshot validation failed: %v\n", err)
+		return
+	}
+
+	fmt.Println("Done! The snapshot matches the blocks")
+}
+
+/*
+@returns: a progress callback printing a line every 1000 blocks and at the end
+*/
+func printProgress(action string) func(done, total int) {
+	return func(done, total int) {
+		if done%1000 == 0 || done == total {
+			fmt.Printf("%s %d/%d blocks\n", action, done, total)
+		}
+	}
+}
+
+func (cli *CommandLine) createBlockchain(address string, genesisFile string, txIndex bool, addrIndex bool) {
+	var chain *blockchain.Blockchain
+
+	if genesisFile != "" {
+		spec, err := blockchain.LoadGenesisSpec(genesisFile)
+		if err != nil {
+			fmt.Println(err)
+			runtime.Goexit()
+		}
+
+		genesis, err := spec.Block(cli.params)
+		if err != nil {
+			fmt.Println(err)
+			runtime.Goexit()
+		}
+
+		chain = blockchain.InitBlockchainWithGenesis(genesis, cli.params)
+	} else {
+		chain = blockchain.InitBlockchain(address, cli.params) //address is the user that mines the genesis block
+	}
+
+	fmt.Printf("Genesis hash: %x\n", chain.LastHash())
+
+	if txIndex {
+		index := blockchain.TxIndex{Blockchain: chain}
+		index.Reindex()
+	}
+
+	if addrIndex {
+		index := blockchain.AddressIndex{Blockchain: chain}
+		index.Reindex()
+	}
+
+	err := chain.Close() //Close the DB
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println("Blockchain created!")
+}
+
+func (cli *CommandLine) getBalance(address string) {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	UTXOs := UTXOSet.FindUTXO(address)
+
+	balance, err := blockchain.SumOutputs(UTXOs)
+	blockchain.Handle(err)
+
+	fmt.Printf("Balance of %s: %s\n", address, balance)
+}
+
+func (cli *CommandLine) reindexUTXO() {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	if prunedHeight, pruned := chain.PrunedHeight(); pruned {
+		fmt.Printf("Can't rebuild the index: the blocks up to height %d have been pruned\n", prunedHeight)
+		return
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	UTXOSet.Reindex()
+
+	count := UTXOSet.CountTransactions()
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+}
+
+func (cli *CommandLine) reindexTx() {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	if prunedHeight, pruned := chain.PrunedHeight(); pruned {
+		fmt.Printf("Can't rebuild the index: the blocks up to height %d have been pruned\n", prunedHeight)
+		return
+	}
+
+	index := blockchain.TxIndex{Blockchain: chain}
+	index.Reindex()
+
+	fmt.Println("Done! The transaction index is enabled.")
+}
+
+func (cli *CommandLine) getTx(txID string) {
+	ID := decodeHex("id", txID)
+
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	tx, block, err := chain.LocateTransaction(ID)
+	if errors.Is(err, blockchain.ErrPruned) {
+		fmt.Printf("Can't find transaction %s: %v\n", txID, err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Transaction %s not found\n", txID)
+		return
+	}
+
+	fmt.Println(tx)
+	fmt.Printf("Block: %x\n", block.Hash)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Confirmations: %d\n", chain.GetBestHeight()-block.Height+1)
+}
+
+func (cli *CommandLine) reindexAddr() {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	if prunedHeight, pruned := chain.PrunedHeight(); pruned {
+		fmt.Printf("Can't rebuild the index: the blocks up to height %d have been pruned\n", prunedHeight)
+		return
+	}
+
+	index := blockchain.AddressIndex{Blockchain: chain}
+	index.Reindex()
+
+	fmt.Println("Done! The address index is enabled.")
+}
+
+func (cli *CommandLine) history(address string, page int, pageSize int) {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	index := blockchain.AddressIndex{Blockchain: chain}
+	if index.Enabled() == false {
+		fmt.Println("The address index is not enabled, run reindexaddr first!")
+		return
+	}
+
+	history, total := index.History(address, (page-1)*pageSize, pageSize)
+
+	fmt.Printf("History of %s (page %d, %d transactions in total):\n", address, page, total)
+	for _, entry := range history {
+		fmt.Printf("Height %d | %x | +%s -%s | balance %s\n", entry.Height, entry.TxID, entry.Received, entry.Sent, entry.Balance)
+	}
+}
+
+func (cli *CommandLine) getBlockCount() {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	fmt.Println(chain.GetBestHeight() + 1) //The Genesis block has height 0
+}
+
+func (cli *CommandLine) getBlockHash(height int) {
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	heightIndex := blockchain.HeightIndex{Blockchain: chain}
+
+	hash, err := heightIndex.GetHash(height)
+	if err != nil {
+		fmt.Printf("Block at height %d not found: %v\n", height, err)
+		return
+	}
+
+	fmt.Printf("%x\n", hash)
+}
+
+func (cli *CommandLine) getBlock(hash string, height int) {
+	var blockHash []byte
+	if hash != "" {
+		blockHash = decodeHex("hash", hash)
+	}
+
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	var block *blockchain.Block
+	var err error
+
+	if blockHash != nil {
+		block, err = chain.GetBlock(blockHash)
+	} else {
+		block, err = chain.GetBlockByHeight(height)
+	}
+
+	if err != nil {
+		fmt.Printf("Block not found: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Hash: %x\n", block.Hash)
+	fmt.Printf("Previous Hash: %x\n", block.PrevHash)
+	fmt.Printf("Height: %d (%d confirmations)\n", block.Height, chain.GetBestHeight()-block.Height+1)
+	fmt.Printf("Time: %s\n", time.Unix(block.Timestamp, 0).UTC().Format(time.RFC3339))
+	fmt.Printf("Nonce: %d\n", block.Nonce)
+	fmt.Printf("Transactions: %d\n", len(block.Transactions))
+
+	for _, tx := range block.Transactions {
+		fmt.Println(tx)
+	}
+}
+
+func (cli *CommandLine) createScript(pubKey string, lock int) {
+	script := blockchain.RedeemScript{PubKey: pubKey, RelativeLock: lock}
+
+	fmt.Printf("Address: %s\n", script.Address(cli.params))
+	fmt.Printf("Redeem script: %x\n", script.Serialize()) //Needed to spend the tokens sent to the address
+}
+
+func (cli *CommandLine) send(from string, payments []blockchain.Payment, redeemScript string, selector blockchain.CoinSelector) {
+	var script *blockchain.RedeemScript
+	if redeemScript != "" {
+		var err error
+
+		script, err = blockchain.DeserializeScript(decodeHex("redeemscript", redeemScript))
+		if err != nil {
+			fmt.Printf("Invalid -redeemscript: %v\n", err)
+			runtime.Goexit()
+		}
+
+		if script.Address(cli.params) != from {
+			fmt.Println("Invalid -redeemscript: the script doesn't match the address of -from")
+			runtime.Goexit()
+		}
+	}
+
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	tx, waste := blockchain.NewPaymentsTransaction(from, script, payments, selector, chain)
+
+	miner := from //The sender mines the block and gets its reward
+	if script != nil {
+		miner = script.PubKey
+	}
+
+	chain.AddBlock(miner, []*blockchain.Transaction{tx})
+
+	fmt.Printf("Coin selection: %d inputs, waste %s\n", len(tx.Inputs), waste)
+	fmt.Printf("Transaction: %x\n", tx.ID)
+
+	for _, payment := range payments {
+		fmt.Printf("[SUCCESS SEND] %s -> %s -> %s\n", from, payment.Amount, payment.Address)
+	}
+}
+
+/*
+Hash of a file that is written in (or looked for in) the blockchain
+*/
+func hashFile(path string) []byte {
+	content, err := os.ReadFile(path)
+	blockchain.Handle(err)
+
+	hash := sha256.Sum256(content)
+
+	return hash[:]
+}
+
+func (cli *CommandLine) notarize(from string, path string) {
+	hash := hashFile(path)
+
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	tx := blockchain.NewDataTransaction(from, hash, chain)
+
+	block := chain.AddBlock(from, []*blockchain.Transaction{tx})
+
+	fmt.Printf("[SUCCESS NOTARIZE] %x in block %x\n", hash, block.Hash)
+}
+
+func (cli *CommandLine) verifyNotary(path string) {
+	hash := hashFile(path)
 
-	for _, address := range addresses {
-		fmt.Println(address)
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	block, err := chain.FindData(hash)
+	if errors.Is(err, blockchain.ErrPruned) {
+		fmt.Printf("Can't find the hash %x of %s: %v\n", hash, path, err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("The hash %x of %s is not in the blockchain\n", hash, path)
+		return
 	}
-}
 
-func (cli *CommandLine) createWallet() {
-	wallets, _ := wallet.CreateWallets()
-	address := wallets.AddWallet()
+	fmt.Printf("File hash: %x\n", hash)
+	fmt.Printf("Block: %x\n", block.Hash)
+	fmt.Printf("Height: %d (%d confirmations)\n", block.Height, chain.GetBestHeight()-block.Height+1)
+	fmt.Printf("Time: %s\n", time.Unix(block.Timestamp, 0).UTC().Format(time.RFC3339))
+}
 
-	wallets.SaveFile()
+/*
+Decodes the hex value of the flag 'name', printing the error and exiting when it isn't valid hex
+*/
+func decodeHex(name string, value string) []byte {
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		fmt.Printf("Invalid -%s: %v\n", name, err)
+		runtime.Goexit()
+	}
 
-	fmt.Printf("New address is: %s\n", address)
+	return data
 }
 
-func (cli *CommandLine) printChain() {
-	chain := blockchain.ContinueBlockchain("")
+/*
+Locks the tokens of an atomic swap in an HTLC contract and mines it
+*/
+func (cli *CommandLine) lockSwap(from string, to string, amount blockchain.Amount, hash []byte, timeout int) []byte {
+	chain := cli.openChain()
 
-	defer func(Database *badger.DB) { //Closes the DB to make sure any pending update is written before closing
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
 		fmt.Println("Closing Badger DB...")
-		err := Database.Close()
+		err := chain.Close()
 		blockchain.Handle(err)
-	}(chain.Database)
+	}(chain)
 
-	iter := chain.Iterator()
+	tx := blockchain.NewHTLCTransaction(from, to, amount, hash, timeout, chain)
 
-	for {
-		block := iter.Next()
+	chain.AddBlock(from, []*blockchain.Transaction{tx})
 
-		fmt.Println()
-		fmt.Printf("Previous Hash: %x\n", block.PrevHash)
-		fmt.Printf("Hash: %x\n", block.Hash)
+	fmt.Printf("Contract: %x\n", tx.ID)
+	fmt.Printf("Refundable by %s from height %d\n", from, tx.Outputs[0].LockTime)
 
-		pow := blockchain.NewProof(block)
-		fmt.Printf("PoW: %s\n", strconv.FormatBool(pow.Validate())) //Proof of work is done on each block, it doesn't store the blocks. Blockchain does
-		fmt.Println()
+	return tx.ID
+}
 
-		//we break out of the for loop when we reach the Genesis block:
-		if len(block.PrevHash) == 0 {
-			break
-		}
+func (cli *CommandLine) initiate(from string, to string, amount blockchain.Amount, timeout int) {
+	secret, hash := blockchain.NewSecret()
+
+	cli.lockSwap(from, to, amount, hash, timeout)
+
+	fmt.Printf("Secret: %x\n", secret) //Keep the secret private until redeeming the participant's contract
+	fmt.Printf("Secret hash: %x\n", hash)
+}
+
+func (cli *CommandLine) participate(from string, to string, amount blockchain.Amount, hash string, timeout int) {
+	hashLock := decodeHex("hash", hash)
+	if len(hashLock) != sha256.Size {
+		fmt.Printf("Invalid -hash: the secret hash is a SHA256 hash of %d bytes, not %d\n", sha256.Size, len(hashLock))
+		runtime.Goexit()
 	}
+
+	cli.lockSwap(from, to, amount, hashLock, timeout)
 }
 
-func (cli *CommandLine) createBlockchain(address string) {
-	chain := blockchain.InitBlockchain(address) //address is the user that mines the genesis block
+func (cli *CommandLine) redeem(contract string, secret string) {
+	contractID := decodeHex("contract", contract)
+	preimage := decodeHex("secret", secret)
 
-	err := chain.Database.Close() //Close the DB
-	if err != nil {
-		log.Panic(err)
-	}
+	chain := cli.openChain()
 
-	fmt.Println("Blockchain created!")
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
+		fmt.Println("Closing Badger DB...")
+		err := chain.Close()
+		blockchain.Handle(err)
+	}(chain)
+
+	tx := blockchain.NewRedeemTransaction(contractID, preimage, chain)
+
+	chain.AddBlock(tx.Outputs[0].PubKey, []*blockchain.Transaction{tx})
+
+	fmt.Printf("[SUCCESS REDEEM] %s -> %s\n", tx.Outputs[0].Value, tx.Outputs[0].PubKey)
+	fmt.Printf("Redeem transaction: %x\n", tx.ID)
 }
 
-func (cli *CommandLine) getBalance(address string) {
-	chain := blockchain.ContinueBlockchain(address)
+func (cli *CommandLine) refund(contract string) {
+	contractID := decodeHex("contract", contract)
 
-	defer func(Database *badger.DB) { //Closes the DB to make sure any pending update is written before closing
+	chain := cli.openChain()
+
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
 		fmt.Println("Closing Badger DB...")
-		err := Database.Close()
+		err := chain.Close()
 		blockchain.Handle(err)
-	}(chain.Database)
+	}(chain)
 
-	balance := 0
-	UTXOs := chain.FindUTXO(address)
+	tx := blockchain.NewRefundTransaction(contractID, chain)
 
-	for _, out := range UTXOs {
-		balance += out.Value
-	}
+	chain.AddBlock(tx.Outputs[0].PubKey, []*blockchain.Transaction{tx})
 
-	fmt.Printf("Balance of %s: %d\n", address, balance)
+	fmt.Printf("[SUCCESS REFUND] %s -> %s\n", tx.Outputs[0].Value, tx.Outputs[0].PubKey)
 }
 
-func (cli *CommandLine) send(from string, to string, amount int) {
-	chain := blockchain.ContinueBlockchain(from)
+func (cli *CommandLine) extractSecret(txID string, hash string) {
+	ID := decodeHex("tx", txID)
+	hashLock := decodeHex("hash", hash)
+
+	chain := cli.openChain()
 
-	defer func(Database *badger.DB) { //Closes the DB to make sure any pending update is written before closing
+	defer func(chain *blockchain.Blockchain) { //Closes the DB to make sure any pending update is written before closing
 		fmt.Println("Closing Badger DB...")
-		err := Database.Close()
+		err := chain.Close()
 		blockchain.Handle(err)
-	}(chain.Database)
+	}(chain)
 
-	tx := blockchain.NewTransaction(from, to, amount, chain)
+	tx, err := chain.FindTransaction(ID)
+	if err != nil {
+		fmt.Printf("Can't find the redeem transaction %x: %v\n", ID, err)
+		return
+	}
 
-	chain.AddBlock([]*blockchain.Transaction{tx})
+	secret, err := blockchain.ExtractSecret(&tx, hashLock)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	fmt.Printf("[SUCCESS SEND] %s -> %d -> %s\n", from, amount, to)
+	fmt.Printf("Secret: %x\n", secret)
 }
 
 func (cli *CommandLine) Run() {
-	cli.validateArgs()
+	args := cli.parseGlobalOptions()
+	cli.validateArgs(args)
 
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)
+	invalidateBlockCmd := flag.NewFlagSet("invalidateblock", flag.ExitOnError)
+	reconsiderBlockCmd := flag.NewFlagSet("reconsiderblock", flag.ExitOnError)
+	exportChainCmd := flag.NewFlagSet("exportchain", flag.ExitOnError)
+	importChainCmd := flag.NewFlagSet("importchain", flag.ExitOnError)
+	dumpUTXOCmd := flag.NewFlagSet("dumputxo", flag.ExitOnError)
+	loadUTXOCmd := flag.NewFlagSet("loadutxo", flag.ExitOnError)
+	validateSnapshotCmd := flag.NewFlagSet("validatesnapshot", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	migrateDBCmd := flag.NewFlagSet("migratedb", flag.ExitOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	createScriptCmd := flag.NewFlagSet("createscript", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	reindexAddrCmd := flag.NewFlagSet("reindexaddr", flag.ExitOnError)
+	historyCmd := flag.NewFlagSet("history", flag.ExitOnError)
+	getBlockCountCmd := flag.NewFlagSet("getblockcount", flag.ExitOnError)
+	getBlockHashCmd := flag.NewFlagSet("getblockhash", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getTxCmd := flag.NewFlagSet("gettx", flag.ExitOnError)
+	notarizeCmd := flag.NewFlagSet("notarize", flag.ExitOnError)
+	verifyNotaryCmd := flag.NewFlagSet("verifynotary", flag.ExitOnError)
+	initiateCmd := flag.NewFlagSet("initiate", flag.ExitOnError)
+	participateCmd := flag.NewFlagSet("participate", flag.ExitOnError)
+	redeemCmd := flag.NewFlagSet("redeem", flag.ExitOnError)
+	refundCmd := flag.NewFlagSet("refund", flag.ExitOnError)
+	extractSecretCmd := flag.NewFlagSet("extractsecret", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
+	createBlockchainTxIndex := createBlockchainCmd.Bool("txindex", false, "Index the transactions by ID")
+	createBlockchainAddrIndex := createBlockchainCmd.Bool("addrindex", false, "Index the history of every address")
+	createBlockchainGenesis := createBlockchainCmd.String("genesis", "", "JSON spec of the Genesis block (replaces -address)")
+	verifyChainDepth := verifyChainCmd.Int("depth", 0, "Number of most recent blocks to check (0 checks every block)")
+	verifyChainLevel := verifyChainCmd.Int("level", blockchain.VerifyUTXO, "Thoroughness of the checks, from 0 to 3")
+	invalidateBlockHash := invalidateBlockCmd.String("hash", "", "Hash of the block to invalidate")
+	reconsiderBlockHash := reconsiderBlockCmd.String("hash", "", "Hash of the block to reconsider")
+	exportChainOut := exportChainCmd.String("out", "", "Bootstrap file to write")
+	importChainIn := importChainCmd.String("in", "", "Bootstrap file to import")
+	dumpUTXOOut := dumpUTXOCmd.String("out", "", "Snapshot file to write")
+	dumpUTXOHeight := dumpUTXOCmd.Int("height", -1, "Height of the UTXO set (the last block by default)")
+	loadUTXOIn := loadUTXOCmd.String("in", "", "Snapshot file to load")
+	loadUTXOHash := loadUTXOCmd.String("hash", "", "Trusted hash of the snapshot (replaces the hash configured for its height)")
+	loadUTXOBlocks := loadUTXOCmd.String("blocks", "", "Bootstrap file with the blocks below the snapshot")
+	validateSnapshotBlocks := validateSnapshotCmd.String("blocks", "", "Bootstrap file with the blocks below the snapshot")
+	migrateDBDryRun := migrateDBCmd.Bool("dryrun", false, "Only list the pending migrations")
+	migrateDBBackup := migrateDBCmd.String("backup", "", "Backup file written before the destructive migrations")
+	getBlockHashHeight := getBlockHashCmd.Int("height", -1, "Height of the block")
+	getBlockHash := getBlockCmd.String("hash", "", "Hash of the block")
+	getBlockHeight := getBlockCmd.Int("height", -1, "Height of the block")
+	historyAddress := historyCmd.String("address", "", "The address to get the history for")
+	historyPage := historyCmd.Int("page", 1, "Page of the history (from the oldest transactions)")
+	historyPageSize := historyCmd.Int("pagesize", 20, "Number of transactions per page")
+	getTxID := getTxCmd.String("id", "", "ID of the transaction")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
-	sendTo := sendCmd.String("to", "", "Destination wallet address")
-	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	var sendTo recipientsFlag
+	sendCmd.Var(&sendTo, "to", "Destination wallet address, or ADDRESS:AMOUNT (can be repeated)")
+	sendCSV := sendCmd.String("csv", "", "CSV file of 'address,amount' payments")
+	sendStrategy := sendCmd.String("strategy", "largest", "Coin selection strategy: largest, smallest, bnb or random")
+	sendAmount := sendCmd.String("amount", "", "Amount to send in coins (ex: 1.25)")
+	sendLock := sendCmd.Int("lock", 0, "Number of blocks the receiver has to wait after confirmation before spending")
+	sendRedeemScript := sendCmd.String("redeemscript", "", "Redeem script of the source pay-to-script-hash address")
+	createScriptPubKey := createScriptCmd.String("pubkey", "", "Account that can spend the tokens sent to the script")
+	createScriptLock := createScriptCmd.Int("lock", 0, "Number of blocks to wait after confirmation before spending")
+	notarizeFrom := notarizeCmd.String("from", "", "Source wallet address that pays for the transaction")
+	notarizeFile := notarizeCmd.String("file", "", "Path of the file to notarize")
+	verifyNotaryFile := verifyNotaryCmd.String("file", "", "Path of the notarized file")
+	initiateFrom := initiateCmd.String("from", "", "Source wallet address")
+	initiateTo := initiateCmd.String("to", "", "Address of the participant")
+	initiateAmount := initiateCmd.String("amount", "", "Amount to swap in coins (ex: 1.25)")
+	initiateTimeout := initiateCmd.Int("timeout", 48, "Number of blocks before the contract can be refunded")
+	participateFrom := participateCmd.String("from", "", "Source wallet address")
+	participateTo := participateCmd.String("to", "", "Address of the initiator")
+	participateAmount := participateCmd.String("amount", "", "Amount to swap in coins (ex: 1.25)")
+	participateHash := participateCmd.String("hash", "", "Secret hash of the initiator's contract")
+	participateTimeout := participateCmd.Int("timeout", 24, "Number of blocks before the contract can be refunded. Must be shorter than the initiator's")
+	redeemContract := redeemCmd.String("contract", "", "ID of the contract transaction")
+	redeemSecret := redeemCmd.String("secret", "", "Secret of the swap")
+	refundContract := refundCmd.String("contract", "", "ID of the contract transaction")
+	extractSecretTx := extractSecretCmd.String("tx", "", "ID of the redeem transaction")
+	extractSecretHash := extractSecretCmd.String("hash", "", "Secret hash of the swap")
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "getbalance":
-		err := getBalanceCmd.Parse(os.Args[2:])
+		err := getBalanceCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "createblockchain":
-		err := createBlockchainCmd.Parse(os.Args[2:])
+		err := createBlockchainCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "printchain":
-		err := printChainCmd.Parse(os.Args[2:])
+		err := printChainCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifychain":
+		err := verifyChainCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "invalidateblock":
+		err := invalidateBlockCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reconsiderblock":
+		err := reconsiderBlockCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "exportchain":
+		err := exportChainCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importchain":
+		err := importChainCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumputxo":
+		err := dumpUTXOCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "loadutxo":
+		err := loadUTXOCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "validatesnapshot":
+		err := validateSnapshotCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "send":
-		err := sendCmd.Parse(os.Args[2:])
+		err := sendCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "createwallet":
-		err := createWalletCmd.Parse(os.Args[2:])
+		err := createWalletCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "listaddresses":
-		err := listAddressesCmd.Parse(os.Args[2:])
+		err := listAddressesCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "migratedb":
+		err := migrateDBCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindexutxo":
+		err := reindexUTXOCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindextx":
+		err := reindexTxCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getblockcount":
+		err := getBlockCountCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getblockhash":
+		err := getBlockHashCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getblock":
+		err := getBlockCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindexaddr":
+		err := reindexAddrCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "history":
+		err := historyCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "gettx":
+		err := getTxCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createscript":
+		err := createScriptCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "notarize":
+		err := notarizeCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifynotary":
+		err := verifyNotaryCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "initiate":
+		err := initiateCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "participate":
+		err := participateCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "redeem":
+		err := redeemCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "refund":
+		err := refundCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "extractsecret":
+		err := extractSecretCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
@@ -191,30 +1299,180 @@ func (cli *CommandLine) Run() {
 			getBalanceCmd.Usage()
 			runtime.Goexit()
 		}
+		cli.checkNetwork(*getBalanceAddress)
 		cli.getBalance(*getBalanceAddress)
 	}
 
 	if createBlockchainCmd.Parsed() {
-		if *createBlockchainAddress == "" {
+		if (*createBlockchainAddress == "") == (*createBlockchainGenesis == "") { //Exactly one of them
 			createBlockchainCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.createBlockchain(*createBlockchainAddress)
+		cli.checkNetwork(*createBlockchainAddress)
+		cli.createBlockchain(*createBlockchainAddress, *createBlockchainGenesis, *createBlockchainTxIndex, *createBlockchainAddrIndex)
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || (len(sendTo) == 0 && *sendCSV == "") || *sendLock < 0 {
+			sendCmd.Usage()
+			runtime.Goexit()
+		}
+
+		payments, err := parsePayments(sendTo, *sendAmount, *sendCSV, *sendLock)
+		if err != nil {
+			fmt.Println(err)
+			sendCmd.Usage()
+			runtime.Goexit()
+		}
+
+		selector, err := blockchain.NewCoinSelector(*sendStrategy)
+		if err != nil {
+			fmt.Println(err)
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		cli.checkNetwork(*sendFrom)
+		for _, payment := range payments {
+			cli.checkNetwork(payment.Address)
+		}
+
+		cli.send(*sendFrom, payments, *sendRedeemScript, selector)
+	}
+
+	if reindexTxCmd.Parsed() {
+		cli.reindexTx()
+	}
+
+	if getBlockCountCmd.Parsed() {
+		cli.getBlockCount()
+	}
+
+	if getBlockHashCmd.Parsed() {
+		if *getBlockHashHeight < 0 {
+			getBlockHashCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.getBlockHash(*getBlockHashHeight)
+	}
+
+	if getBlockCmd.Parsed() {
+		if (*getBlockHash == "") == (*getBlockHeight < 0) { //Exactly one of hash and height
+			getBlockCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.getBlock(*getBlockHash, *getBlockHeight)
+	}
+
+	if reindexAddrCmd.Parsed() {
+		cli.reindexAddr()
+	}
+
+	if historyCmd.Parsed() {
+		if *historyAddress == "" || *historyPage < 1 || *historyPageSize < 1 {
+			historyCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.history(*historyAddress, *historyPage, *historyPageSize)
+	}
+
+	if getTxCmd.Parsed() {
+		if *getTxID == "" {
+			getTxCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.getTx(*getTxID)
+	}
+
+	if createScriptCmd.Parsed() {
+		if *createScriptPubKey == "" || *createScriptLock < 0 {
+			createScriptCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.createScript(*createScriptPubKey, *createScriptLock)
 	}
 
 	if printChainCmd.Parsed() {
 		cli.printChain()
 	}
 
+	if exportChainCmd.Parsed() {
+		if *exportChainOut == "" {
+			exportChainCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.exportChain(*exportChainOut)
+	}
+
+	if importChainCmd.Parsed() {
+		if *importChainIn == "" {
+			importChainCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.importChain(*importChainIn)
+	}
+
+	if dumpUTXOCmd.Parsed() {
+		if *dumpUTXOOut == "" {
+			dumpUTXOCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.dumpUTXO(*dumpUTXOOut, *dumpUTXOHeight)
+	}
+
+	if loadUTXOCmd.Parsed() {
+		if *loadUTXOIn == "" {
+			loadUTXOCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.loadUTXO(*loadUTXOIn, *loadUTXOHash, *loadUTXOBlocks)
+	}
+
+	if validateSnapshotCmd.Parsed() {
+		if *validateSnapshotBlocks == "" {
+			validateSnapshotCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.validateSnapshot(*validateSnapshotBlocks)
+	}
+
+	if verifyChainCmd.Parsed() {
+		if *verifyChainDepth < 0 || *verifyChainLevel < blockchain.VerifyBlocks || *verifyChainLevel > blockchain.VerifyUTXO {
+			verifyChainCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.verifyChain(*verifyChainDepth, *verifyChainLevel)
+	}
+
+	if invalidateBlockCmd.Parsed() {
+		if *invalidateBlockHash == "" {
+			invalidateBlockCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.invalidateBlock(*invalidateBlockHash)
+	}
+
+	if reconsiderBlockCmd.Parsed() {
+		if *reconsiderBlockHash == "" {
+			reconsiderBlockCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.reconsiderBlock(*reconsiderBlockHash)
+	}
+
 	if createWalletCmd.Parsed() {
 		cli.createWallet()
 	}
@@ -222,4 +1480,80 @@ func (cli *CommandLine) Run() {
 	if listAddressesCmd.Parsed() {
 		cli.listAddresses()
 	}
+
+	if migrateDBCmd.Parsed() {
+		cli.migrateDB(*migrateDBDryRun, *migrateDBBackup)
+	}
+
+	if reindexUTXOCmd.Parsed() {
+		cli.reindexUTXO()
+	}
+
+	if notarizeCmd.Parsed() {
+		if *notarizeFrom == "" || *notarizeFile == "" {
+			notarizeCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.checkNetwork(*notarizeFrom)
+		cli.notarize(*notarizeFrom, *notarizeFile)
+	}
+
+	if verifyNotaryCmd.Parsed() {
+		if *verifyNotaryFile == "" {
+			verifyNotaryCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.verifyNotary(*verifyNotaryFile)
+	}
+
+	if initiateCmd.Parsed() {
+		amount, err := blockchain.ParseAmount(*initiateAmount)
+		if *initiateFrom == "" || *initiateTo == "" || err != nil || amount == 0 || *initiateTimeout <= 0 {
+			initiateCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.checkNetwork(*initiateFrom, *initiateTo)
+		cli.initiate(*initiateFrom, *initiateTo, amount, *initiateTimeout)
+	}
+
+	if participateCmd.Parsed() {
+		amount, err := blockchain.ParseAmount(*participateAmount)
+		if *participateFrom == "" || *participateTo == "" || err != nil || amount == 0 || *participateHash == "" || *participateTimeout <= 0 {
+			participateCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.checkNetwork(*participateFrom, *participateTo)
+		cli.participate(*participateFrom, *participateTo, amount, *participateHash, *participateTimeout)
+	}
+
+	if redeemCmd.Parsed() {
+		if *redeemContract == "" || *redeemSecret == "" {
+			redeemCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.redeem(*redeemContract, *redeemSecret)
+	}
+
+	if refundCmd.Parsed() {
+		if *refundContract == "" {
+			refundCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.refund(*refundContract)
+	}
+
+	if extractSecretCmd.Parsed() {
+		if *extractSecretTx == "" || *extractSecretHash == "" {
+			extractSecretCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.extractSecret(*extractSecretTx, *extractSecretHash)
+	}
 }
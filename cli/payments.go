@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pierobassa/golang-blockchain/blockchain"
+)
+
+/*
+Flag that can be repeated to collect every recipient of the send command:
+  - "ADDRESS" uses the -amount flag (only one recipient can be given this way)
+  - "ADDRESS:AMOUNT" pays AMOUNT to ADDRESS
+
+Amounts are decimal numbers of coins (ex: 1.25)
+*/
+type recipientsFlag []string
+
+func (r *recipientsFlag) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *recipientsFlag) Set(value string) error {
+	*r = append(*r, value)
+
+	return nil
+}
+
+/*
+Builds the payments of the send command from the -to flags, the -amount flag and the CSV file (if any)
+
+@param lock: relative lock applied to every payment
+@returns: the payments or an error if a recipient or an amount is invalid
+*/
+func parsePayments(recipients recipientsFlag, amount string, csvPath string, lock int) ([]blockchain.Payment, error) {
+	var payments []blockchain.Payment
+
+	for _, recipient := range recipients {
+		address, value, found := strings.Cut(recipient, ":")
+
+		if found == false {
+			if len(recipients) > 1 {
+				return nil, fmt.Errorf("recipient %s has no amount, use ADDRESS:AMOUNT when paying more than one recipient", recipient)
+			}
+
+			value = amount
+		}
+
+		paymentAmount, err := blockchain.ParseAmount(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount for %s: %v", address, err)
+		}
+
+		payments = append(payments, blockchain.Payment{Address: address, Amount: paymentAmount, RelativeLock: lock})
+	}
+
+	if csvPath != "" {
+		csvPayments, err := readPaymentsFile(csvPath, lock)
+		if err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, csvPayments...)
+	}
+
+	for _, payment := range payments {
+		if payment.Address == "" || payment.Amount == 0 {
+			return nil, fmt.Errorf("invalid payment of %s to '%s'", payment.Amount, payment.Address)
+		}
+	}
+
+	return payments, nil
+}
+
+/*
+Reads the payments from a CSV file with one "address,amount" record per line
+*/
+func readPaymentsFile(path string, lock int) ([]blockchain.Payment, error) {
+	var payments []blockchain.Payment
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for line, record := range records {
+		amount, err := blockchain.ParseAmount(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid amount: %v", path, line+1, err)
+		}
+
+		payments = append(payments, blockchain.Payment{Address: record[0], Amount: amount, RelativeLock: lock})
+	}
+
+	return payments, nil
+}
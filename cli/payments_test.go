@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pierobassa/golang-blockchain/blockchain"
+)
+
+func TestParsePayments(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "payroll.csv")
+	if err := os.WriteFile(csvPath, []byte("carol, 2\ndave,0.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	payments, err := parsePayments(recipientsFlag{"alice:1.25", "bob:3"}, "", csvPath, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []blockchain.Payment{
+		{Address: "alice", Amount: 125000000, RelativeLock: 4},
+		{Address: "bob", Amount: 300000000, RelativeLock: 4},
+		{Address: "carol", Amount: 200000000, RelativeLock: 4},
+		{Address: "dave", Amount: 50000000, RelativeLock: 4},
+	}
+	if !reflect.DeepEqual(payments, want) {
+		t.Fatalf("payments = %+v, want %+v", payments, want)
+	}
+
+	//A single recipient can take its amount from -amount
+	payments, err = parsePayments(recipientsFlag{"alice"}, "1", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 || payments[0].Amount != blockchain.UnitsPerCoin {
+		t.Fatalf("payments = %+v, want 1 coin to alice", payments)
+	}
+}
+
+func TestParsePaymentsErrors(t *testing.T) {
+	tests := map[string]recipientsFlag{
+		"many recipients without amount": {"alice", "bob:1"},
+		"negative amount":                {"alice:-1"},
+		"zero amount":                    {"alice:0"},
+		"no address":                     {":1"},
+		"too many decimals":              {"alice:0.123456789"},
+	}
+
+	for name, recipients := range tests {
+		if _, err := parsePayments(recipients, "", "", 0); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	csvPath := filepath.Join(t.TempDir(), "payroll.csv")
+	if err := os.WriteFile(csvPath, []byte("carol\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parsePayments(nil, "", csvPath, 0); err == nil {
+		t.Error("a CSV record without amount: no error")
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/pierobassa/golang-blockchain
 
-go 1.19
+go 1.23
 
 require (
 	github.com/dgraph-io/badger v1.6.2
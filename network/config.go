@@ -0,0 +1,102 @@
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+/*
+The hashes a deployment publishes can't be part of the parameters of the networks, as every deployment has its own Genesis block.
+They are read from the file ConfigFile of the network directory when the network is selected (see Select):
+
+	{
+		"checkpoints": {"1000": "00a1...", "2000": "003f..."},
+		"assumevalid": 2000,
+		"assumeutxo": {"1500": "9c4e..."}
+	}
+
+'assumevalid' is the height of one of the checkpoints. The values of the file are added to the ones of the parameters
+*/
+const ConfigFile = "checkpoints.json"
+
+type config struct {
+	Checkpoints map[string]string `json:"checkpoints"`
+	AssumeValid int               `json:"assumevalid"`
+	AssumeUTXO  map[string]string `json:"assumeutxo"`
+}
+
+/*
+Adds the checkpoints, the assumed-valid block and the trusted snapshot hashes of the ConfigFile of the network directory (if any)
+
+@returns: an error if the file can't be read or has invalid values
+*/
+func (p *ChainParams) loadConfig() error {
+	path := filepath.Join(Dir(p), ConfigFile)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	//The maps of the parameters are shared with the networks, new ones are made
+	checkpoints, err := mergeHashes(p.Checkpoints, c.Checkpoints, 32)
+	if err != nil {
+		return fmt.Errorf("%s: checkpoints: %v", path, err)
+	}
+
+	assumeUTXO, err := mergeHashes(p.AssumeUTXO, c.AssumeUTXO, 32)
+	if err != nil {
+		return fmt.Errorf("%s: assumeutxo: %v", path, err)
+	}
+
+	p.Checkpoints, p.AssumeUTXO = checkpoints, assumeUTXO
+
+	if c.AssumeValid != 0 {
+		hash, found := p.Checkpoints[c.AssumeValid]
+		if !found {
+			return fmt.Errorf("%s: the assumed-valid height %d isn't a checkpoint", path, c.AssumeValid)
+		}
+
+		p.AssumeValid, p.AssumeValidHeight = hash, c.AssumeValid
+	}
+
+	return nil
+}
+
+/*
+Copy of 'hashes' with the hashes of 'added' (height in decimal => hash in hex of 'size' bytes)
+*/
+func mergeHashes(hashes map[int]string, added map[string]string, size int) (map[int]string, error) {
+	merged := make(map[int]string, len(hashes)+len(added))
+	for height, hash := range hashes {
+		merged[height] = hash
+	}
+
+	for key, hash := range added {
+		height, err := strconv.Atoi(key)
+		if err != nil || height < 0 {
+			return nil, fmt.Errorf("invalid height %q", key)
+		}
+
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != size {
+			return nil, fmt.Errorf("invalid hash %q at height %d", hash, height)
+		}
+
+		merged[height] = hash
+	}
+
+	return merged, nil
+}
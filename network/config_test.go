@@ -0,0 +1,69 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dataDir string, content string) {
+	t.Helper()
+
+	dir := filepath.Join(dataDir, RegTest.SubDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectLoadsTheConfigFile(t *testing.T) {
+	hash1, hash2 := strings.Repeat("01", 32), strings.Repeat("02", 32)
+
+	dataDir := t.TempDir()
+	writeConfig(t, dataDir, `{"checkpoints": {"10": "`+hash1+`", "20": "`+hash2+`"}, "assumevalid": 20, "assumeutxo": {"15": "`+hash1+`"}}`)
+
+	params, err := Select(RegTest.Name, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params.Checkpoints[10] != hash1 || params.Checkpoints[20] != hash2 || params.AssumeUTXO[15] != hash1 {
+		t.Errorf("Select() = checkpoints %v, assumeutxo %v", params.Checkpoints, params.AssumeUTXO)
+	}
+	if params.AssumeValid != hash2 || params.AssumeValidHeight != 20 {
+		t.Errorf("Select() = assumed-valid block %q at %d, want the checkpoint at 20", params.AssumeValid, params.AssumeValidHeight)
+	}
+
+	if RegTest.Checkpoints != nil || RegTest.AssumeValid != "" {
+		t.Error("the parameters of the network have been changed")
+	}
+
+	//Without a file, the parameters of the network
+	params, err = Select(RegTest.Name, t.TempDir())
+	if err != nil || len(params.Checkpoints) != 0 || params.AssumeValid != "" {
+		t.Errorf("Select() without a file = %+v, %v", params, err)
+	}
+}
+
+func TestSelectRefusesAnInvalidConfigFile(t *testing.T) {
+	hash := strings.Repeat("01", 32)
+
+	for _, content := range []string{
+		`{"checkpoints": {"10": "` + hash + `"}, "assumevalid": 11}`, //Not a checkpoint
+		`{"checkpoints": {"ten": "` + hash + `"}}`,
+		`{"checkpoints": {"10": "0102"}}`,
+		`{"assumeutxo": {"10": "zz"}}`,
+		`{"checkpoints": `,
+	} {
+		dataDir := t.TempDir()
+		writeConfig(t, dataDir, content)
+
+		if _, err := Select(RegTest.Name, dataDir); err == nil {
+			t.Errorf("Select() accepted the config %s", content)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	DefaultDataDir = "./tmp"
+	DataDirEnv     = "BLOCKCHAIN_DATADIR" //Environment variable that overrides the default data directory
+	NetworkEnv     = "BLOCKCHAIN_NETWORK" //Environment variable that overrides the default network
+)
+
+/*
+Returns the parameters of the network with the data directory in use (a copy, the parameters of the networks aren't changed)
+and the hashes of the ConfigFile of the network directory.
+Empty values fall back to the environment variables and then to the defaults (main network in ./tmp)
+*/
+func Select(name string, dataDir string) (*ChainParams, error) {
+	if name == "" {
+		name = os.Getenv(NetworkEnv)
+	}
+	if name == "" {
+		name = MainNet.Name
+	}
+
+	if dataDir == "" {
+		dataDir = os.Getenv(DataDirEnv)
+	}
+	if dataDir == "" {
+		dataDir = DefaultDataDir
+	}
+
+	params, err := ByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := *params
+	selected.DataDir = dataDir
+
+	if err := selected.loadConfig(); err != nil {
+		return nil, err
+	}
+
+	return &selected, nil
+}
+
+/*
+Directory of the files of a network, in the data directory of its parameters (DefaultDataDir when it is empty)
+*/
+func Dir(params *ChainParams) string {
+	dataDir := params.DataDir
+	if dataDir == "" {
+		dataDir = DefaultDataDir
+	}
+
+	return filepath.Join(dataDir, params.SubDir)
+}
+
+/*
+Directory of the Badger DB of a network
+*/
+func BlocksDir(params *ChainParams) string {
+	return filepath.Join(Dir(params), "blocks")
+}
+
+/*
+File of the wallets of a network
+*/
+func WalletFile(params *ChainParams) string {
+	return filepath.Join(Dir(params), "wallets.data")
+}
@@ -0,0 +1,138 @@
+package network
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+The consensus rules of a chain. Every network has its own parameters: its data lives in its own subdirectory
+of the data directory and its addresses use different version bytes, so the networks can never mix.
+  - Name: name used to select the network
+  - SubDir: subdirectory of the data directory (the main network uses the data directory itself)
+  - DataDir: data directory of the node, chosen with Select (it isn't a rule of the chain, the networks leave it empty)
+  - GenesisData: data of the coinbase transaction of the Genesis block, so every network has a different Genesis block
+  - InitialReward: tokens (in the smallest unit) paid by the coinbase transactions of the first blocks
+  - HalvingInterval: number of blocks after which the reward is halved (0 means it never changes)
+  - Difficulty: number of leading zero bits a block hash must have
+  - TargetSpacing: time between two blocks the difficulty is chosen for
+  - AddressVersion / ScriptHashVersion: version bytes of the Base58Check addresses
+  - MaxBlockSize: maximum size in bytes of the serialized transactions of a block
+  - CoinbaseMaturity: number of blocks that must be mined after a coinbase transaction before its outputs can be spent
+  - AssumeUTXO: content hash (hex) of the trusted UTXO snapshot at each height (see blockchain.UTXOSnapshot)
+  - Checkpoints: hash (hex) of the block at each height. A block at one of these heights with another hash is rejected
+  - AssumeValid / AssumeValidHeight: hash (hex) and height of a checkpoint block. The inputs of the block and of its ancestors
+    aren't checked against the outputs they unlock
+*/
+type ChainParams struct {
+	Name              string
+	SubDir            string
+	DataDir           string
+	GenesisData       string
+	InitialReward     uint64
+	HalvingInterval   int
+	Difficulty        int
+	TargetSpacing     time.Duration
+	AddressVersion    byte
+	ScriptHashVersion byte
+	MaxBlockSize      int
+	CoinbaseMaturity  int
+	AssumeUTXO        map[int]string
+	Checkpoints       map[int]string
+	AssumeValid       string
+	AssumeValidHeight int
+}
+
+// A block is mined by the account that creates it (ex: the sender of send), whose only tokens can be the reward of the Genesis block,
+// so a coinbase maturity above 0 would keep the first account from ever creating a block on these networks: CoinbaseMaturity is
+// deliberately 0 everywhere until blocks can be mined without a transaction (the rule is enforced for any chain configured with more).
+// The Genesis block pays the address chosen by createblockchain, so every deployment has its own UTXO snapshots:
+// AssumeUTXO is left empty and the trusted hash is given to loadutxo, unless a deployment configures the hashes of the snapshots it publishes
+// (loadutxo -hash can't override them). Checkpoints and AssumeValid are left empty for the same reason:
+// a deployment adds the hashes of its own published blocks to the ConfigFile of the network directory (see Select)
+var (
+	MainNet = ChainParams{
+		Name:              "main",
+		SubDir:            "",
+		GenesisData:       "First Transaction from Genesis",
+		InitialReward:     100 * 100000000,
+		HalvingInterval:   210000,
+		Difficulty:        18,
+		TargetSpacing:     10 * time.Minute,
+		AddressVersion:    0x00,
+		ScriptHashVersion: 0x05,
+		MaxBlockSize:      1000000,
+		CoinbaseMaturity:  0,
+	}
+
+	TestNet = ChainParams{
+		Name:              "test",
+		SubDir:            "testnet",
+		GenesisData:       "First Transaction from Genesis of the test network",
+		InitialReward:     100 * 100000000,
+		HalvingInterval:   210000,
+		Difficulty:        16,
+		TargetSpacing:     10 * time.Minute,
+		AddressVersion:    0x6f,
+		ScriptHashVersion: 0xc4,
+		MaxBlockSize:      1000000,
+		CoinbaseMaturity:  0,
+	}
+
+	//Regression test network: blocks are mined almost instantly so local tests are fast
+	RegTest = ChainParams{
+		Name:              "regtest",
+		SubDir:            "regtest",
+		GenesisData:       "First Transaction from Genesis of the regression test network",
+		InitialReward:     100 * 100000000,
+		HalvingInterval:   150,
+		Difficulty:        8,
+		TargetSpacing:     10 * time.Minute,
+		AddressVersion:    0x7a,
+		ScriptHashVersion: 0x7c,
+		MaxBlockSize:      1000000,
+		CoinbaseMaturity:  0,
+	}
+)
+
+/*
+Returns the parameters of the network with the given name: "main", "test" or "regtest"
+*/
+func ByName(name string) (*ChainParams, error) {
+	for _, params := range []*ChainParams{&MainNet, &TestNet, &RegTest} {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown network %s", name)
+}
+
+/*
+Returns the network whose addresses use the given version byte (for a wallet or a pay-to-script-hash address)
+*/
+func ByVersion(version byte) (*ChainParams, bool) {
+	for _, params := range []*ChainParams{&MainNet, &TestNet, &RegTest} {
+		if params.AddressVersion == version || params.ScriptHashVersion == version {
+			return params, true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+Reward schedule: the tokens (in the smallest unit) a coinbase transaction can pay in the block at 'height'
+*/
+func (p *ChainParams) Reward(height int) uint64 {
+	if p.HalvingInterval == 0 {
+		return p.InitialReward
+	}
+
+	halvings := height / p.HalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+
+	return p.InitialReward >> halvings
+}
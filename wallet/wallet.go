@@ -1,18 +1,20 @@
 package wallet
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"fmt"
+	"github.com/mr-tron/base58"
+	"github.com/pierobassa/golang-blockchain/network"
 	"golang.org/x/crypto/ripemd160"
 	"log"
 )
 
-const (
-	checksumLength = 4
-	version        = byte(0x00) //Hex representation of zero
-)
+// The version bytes of the addresses depend on the network (see network.ChainParams)
+const checksumLength = 4
 
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
@@ -89,18 +91,12 @@ func Checksum(payload []byte) []byte {
 }
 
 /*
-Creates the Address of a Wallet
+Creates the Address of a Wallet on the network of 'params'
 */
-func (w Wallet) Address() []byte {
+func (w Wallet) Address(params *network.ChainParams) []byte {
 	pubHash := PublicKeyHash(w.PublicKey)
 
-	versionedHash := append([]byte{version}, pubHash...) //concatenating version with the public key hash
-
-	checksum := Checksum(versionedHash)
-
-	fullHash := append(versionedHash, checksum...)
-
-	address := Base58Encode(fullHash)
+	address := encodeAddress(params.AddressVersion, pubHash)
 
 	//fmt.Printf("NEW WALLET:\n")
 	//fmt.Printf("Public key: %x\n", w.PublicKey)
@@ -109,3 +105,78 @@ func (w Wallet) Address() []byte {
 
 	return address
 }
+
+/*
+Creates the pay-to-script-hash Address of a redeem script given the hash of the script
+*/
+func ScriptHashAddress(scriptHash []byte, params *network.ChainParams) []byte {
+	return encodeAddress(params.ScriptHashVersion, scriptHash)
+}
+
+/*
+Retrieves the script hash from a pay-to-script-hash Address
+
+@returns: the script hash and false if the address isn't a valid pay-to-script-hash address of the network of 'params'
+*/
+func DecodeScriptHashAddress(address string, params *network.ChainParams) ([]byte, bool) {
+	version, hash, ok := decodeAddress(address)
+	if !ok || version != params.ScriptHashVersion {
+		return nil, false
+	}
+
+	return hash, true
+}
+
+/*
+Checks that an address can be used on the network of 'params'. Any string that isn't a Base58Check address is an account name,
+a Base58Check address must have one of the version bytes of the network: the address of another network would otherwise be
+taken for an account name and the tokens sent to it would be lost
+
+@returns: an error naming the network of the address if it belongs to another one
+*/
+func CheckNetwork(address string, params *network.ChainParams) error {
+	version, _, ok := decodeAddress(address)
+	if !ok || version == params.AddressVersion || version == params.ScriptHashVersion {
+		return nil
+	}
+
+	if other, found := network.ByVersion(version); found {
+		return fmt.Errorf("%s is an address of the %s network, not of the %s network", address, other.Name, params.Name)
+	}
+
+	return fmt.Errorf("%s has the unknown version byte 0x%02x", address, version)
+}
+
+/*
+Decodes a Base58Check address: version byte + hash + checksum
+
+@returns: the version byte, the hash and false if the string isn't a Base58Check address
+*/
+func decodeAddress(address string) (byte, []byte, bool) {
+	fullHash, err := base58.Decode(address) //Not using Base58Decode because any string can be passed here, we don't want to panic
+	if err != nil || len(fullHash) != 1+ripemd160.Size+checksumLength {
+		return 0, nil, false
+	}
+
+	versionedHash := fullHash[:len(fullHash)-checksumLength]
+	checksum := fullHash[len(fullHash)-checksumLength:]
+
+	if bytes.Equal(Checksum(versionedHash), checksum) == false {
+		return 0, nil, false
+	}
+
+	return versionedHash[0], versionedHash[1:], true
+}
+
+/*
+Base58Check encoding of a hash: version byte + hash + checksum
+*/
+func encodeAddress(version byte, hash []byte) []byte {
+	versionedHash := append([]byte{version}, hash...) //concatenating version with the hash
+
+	checksum := Checksum(versionedHash)
+
+	fullHash := append(versionedHash, checksum...)
+
+	return Base58Encode(fullHash)
+}
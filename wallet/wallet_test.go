@@ -0,0 +1,54 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/pierobassa/golang-blockchain/network"
+)
+
+var networks = []*network.ChainParams{&network.MainNet, &network.TestNet, &network.RegTest}
+
+func TestVersionBytesAreUnique(t *testing.T) {
+	seen := make(map[byte]string)
+
+	for _, params := range networks {
+		for _, version := range []byte{params.AddressVersion, params.ScriptHashVersion} {
+			if other, found := seen[version]; found {
+				t.Errorf("the %s and %s networks share the version byte 0x%02x", other, params.Name, version)
+			}
+			seen[version] = params.Name
+		}
+	}
+}
+
+func TestCheckNetwork(t *testing.T) {
+	hash := PublicKeyHash([]byte("script"))
+
+	for _, from := range networks {
+		addresses := []string{string(encodeAddress(from.AddressVersion, hash)), string(ScriptHashAddress(hash, from))}
+
+		for _, to := range networks {
+			for _, address := range addresses {
+				err := CheckNetwork(address, to)
+				if (err == nil) != (from == to) {
+					t.Errorf("CheckNetwork(address of %s, %s) = %v", from.Name, to.Name, err)
+				}
+			}
+
+			_, ok := DecodeScriptHashAddress(addresses[1], to)
+			if ok != (from == to) {
+				t.Errorf("DecodeScriptHashAddress(address of %s, %s) = %v", from.Name, to.Name, ok)
+			}
+		}
+	}
+
+	for _, name := range []string{"alice", "", string(encodeAddress(0x01, hash))[1:]} {
+		if err := CheckNetwork(name, &network.RegTest); err != nil {
+			t.Errorf("CheckNetwork(%q) refused an account name: %v", name, err)
+		}
+	}
+
+	if err := CheckNetwork(string(encodeAddress(0x01, hash)), &network.RegTest); err == nil {
+		t.Error("CheckNetwork accepted an unknown version byte")
+	}
+}
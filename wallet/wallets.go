@@ -7,23 +7,25 @@ import (
 	"fmt"
 	"log"
 	"os"
+
+	"github.com/pierobassa/golang-blockchain/network"
 )
 
 /*
 We're not using the BadgerDB for storing wallets because we want to use the BadgerDB exclusively for storing the blockchain.
+The wallets are stored in the directory of their network (see network.WalletFile)
 */
 
-const walletFile = "./tmp/wallets.data"
-
 type Wallets struct {
-	Wallets map[string]*Wallet //Map address => Pointer to Wallet
+	Wallets map[string]*Wallet   //Map address => Pointer to Wallet
+	params  *network.ChainParams //Network of the wallets (unexported so it isn't saved in the file)
 }
 
 /*
 Create wallets
 */
-func CreateWallets() (*Wallets, error) {
-	wallets := Wallets{}
+func CreateWallets(params *network.ChainParams) (*Wallets, error) {
+	wallets := Wallets{params: params}
 	wallets.Wallets = make(map[string]*Wallet)
 
 	err := wallets.LoadFile()
@@ -60,7 +62,7 @@ Add a new Wallet to all the Wallets
 func (ws *Wallets) AddWallet() string {
 	wallet := MakeWallet()
 
-	address := fmt.Sprintf("%s", wallet.Address())
+	address := fmt.Sprintf("%s", wallet.Address(ws.params))
 
 	ws.Wallets[address] = wallet
 
@@ -82,7 +84,12 @@ func (ws *Wallets) SaveFile() {
 		log.Panic(err)
 	}
 
-	err = os.WriteFile(walletFile, content.Bytes(), 0644) //0644 is read & write permissions
+	err = os.MkdirAll(network.Dir(ws.params), 0755)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	err = os.WriteFile(network.WalletFile(ws.params), content.Bytes(), 0644) //0644 is read & write permissions
 
 	if err != nil {
 		log.Panic(err)
@@ -93,13 +100,13 @@ func (ws *Wallets) SaveFile() {
 Loads all the Wallets
 */
 func (ws *Wallets) LoadFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	if _, err := os.Stat(network.WalletFile(ws.params)); os.IsNotExist(err) {
 		return err
 	}
 
 	var wallets Wallets
 
-	fileContent, err := os.ReadFile(walletFile)
+	fileContent, err := os.ReadFile(network.WalletFile(ws.params))
 
 	if err != nil {
 		return err